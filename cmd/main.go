@@ -1,10 +1,16 @@
 package main
 
 import (
+	"os"
+
 	"ruzta/pkg/tokenizer"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "tokens" {
+		os.Exit(runTokens(os.Args[2:]))
+	}
+
 	newTokenizer := tokenizer.NewTokenizer(`
 mod Demo {
     // Single-line comment
@@ -35,11 +41,7 @@ mod Demo {
     }
 }
 `)
-	for {
-		newToken := newTokenizer.Scan()
+	for newToken := range newTokenizer.Tokens() {
 		println("Token: " + newToken.GetDebugName())
-		if newToken.Type == tokenizer.EOF {
-			break
-		}
 	}
 }
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"ruzta/pkg/tokenizer"
+)
+
+const tokensUsage = `usage: ruzta tokens [-format human|json|compact] <file.rz>
+
+Prints every token of a file with its kind, span, source text and literal
+value. A file name of "-" reads standard input. Diagnostics go to standard
+error and the exit status is 1 if any of them is an error.
+
+Formats:
+  human    aligned columns for reading
+  json     one JSON object per line
+  compact  one "start-end kind source literal" line per token, for golden
+           files
+
+Number literals with a suffix show it after the value, as in 300u8.
+`
+
+// runTokens runs the tokens command and returns the exit status.
+func runTokens(args []string) int {
+	flags := flag.NewFlagSet("tokens", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), tokensUsage) }
+	format := flags.String("format", "human", "output format: human, json or compact")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	var print func(io.Writer, tokenizer.Token) error
+	switch *format {
+	case "human":
+		print = printHuman
+	case "json":
+		print = printJSON
+	case "compact":
+		print = printCompact
+	default:
+		fmt.Fprintf(os.Stderr, "ruzta tokens: unknown format %q\n", *format)
+		return 2
+	}
+
+	name := flags.Arg(0)
+	var input io.Reader = os.Stdin
+	if name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ruzta tokens: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		input = file
+	}
+
+	t := tokenizer.NewReaderTokenizer(bufio.NewReader(input))
+	t.SetFileName(name)
+	out := bufio.NewWriter(os.Stdout)
+	var w io.Writer = out
+	var table *tabwriter.Writer
+	if *format == "human" {
+		table = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		w = table
+	}
+	for token := range t.Tokens() {
+		if err := print(w, token); err != nil {
+			fmt.Fprintf(os.Stderr, "ruzta tokens: %v\n", err)
+			return 1
+		}
+	}
+	if table != nil {
+		table.Flush()
+	}
+	if err := out.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "ruzta tokens: %v\n", err)
+		return 1
+	}
+
+	if err := t.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "ruzta tokens: %v\n", err)
+		return 1
+	}
+	for _, d := range t.Diagnostics() {
+		fmt.Fprintln(os.Stderr, d)
+	}
+	if t.HasErrors() {
+		return 1
+	}
+	return 0
+}
+
+func printHuman(w io.Writer, token tokenizer.Token) error {
+	start, end := token.Span.Start, token.Span.End
+	_, err := fmt.Fprintf(w, "%d:%d-%d:%d\t%s\t%q\t%s\n", start.Line, start.Column, end.Line, end.Column,
+		token.GetName(), token.Source, literalText(token))
+	return err
+}
+
+func printCompact(w io.Writer, token tokenizer.Token) error {
+	start, end := token.Span.Start, token.Span.End
+	line := fmt.Sprintf("%d:%d-%d:%d %s %q", start.Line, start.Column, end.Line, end.Column, token.GetName(), token.Source)
+	if text := literalText(token); text != "" {
+		line += " " + text
+	}
+	_, err := fmt.Fprintln(w, line)
+	return err
+}
+
+type jsonPosition struct {
+	Offset      int `json:"offset"`
+	Line        int `json:"line"`
+	Column      int `json:"column"`
+	UTF16Column int `json:"utf16Column"`
+}
+
+type jsonToken struct {
+	Kind    string       `json:"kind"`
+	Start   jsonPosition `json:"start"`
+	End     jsonPosition `json:"end"`
+	Source  string       `json:"source"`
+	Literal interface{}  `json:"literal,omitempty"`
+	Number  string       `json:"numberKind,omitempty"`
+	Doc     string       `json:"doc,omitempty"`
+}
+
+func printJSON(w io.Writer, token tokenizer.Token) error {
+	record := jsonToken{
+		Kind:    token.GetName(),
+		Start:   jsonPosition(token.Span.Start),
+		End:     jsonPosition(token.Span.End),
+		Source:  token.Source,
+		Literal: literalValue(token),
+		Doc:     token.Doc,
+	}
+	if token.NumberKind != tokenizer.NUMBER_UNTYPED {
+		record.Number = token.NumberKind.String()
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(record)
+}
+
+// literalValue returns the literal of token as a value encoding/json can
+// write. Integers beyond int64 and non-finite floats become strings.
+func literalValue(token tokenizer.Token) interface{} {
+	switch value := token.Literal.(type) {
+	case *big.Int:
+		return value.String()
+	case float64:
+		if math.IsInf(value, 0) || math.IsNaN(value) {
+			return strconv.FormatFloat(value, 'g', -1, 64)
+		}
+		return value
+	case tokenizer.StringNameLiteral:
+		return string(value)
+	case tokenizer.NodePathLiteral:
+		return value.Path
+	default:
+		return value
+	}
+}
+
+// literalText formats the literal of token for the text formats. Strings are
+// quoted so that an empty or blank value stays visible, and typed numbers
+// are followed by their suffix.
+func literalText(token tokenizer.Token) string {
+	if token.NumberKind != tokenizer.NUMBER_UNTYPED {
+		return fmt.Sprint(token.Literal) + token.NumberKind.String()
+	}
+	switch value := token.Literal.(type) {
+	case nil:
+		if token.Type == tokenizer.LITERAL {
+			return "null"
+		}
+		return ""
+	case string:
+		return strconv.Quote(value)
+	case tokenizer.StringNameLiteral:
+		return "&" + strconv.Quote(string(value))
+	case tokenizer.NodePathLiteral:
+		return "^" + strconv.Quote(value.Path)
+	default:
+		return fmt.Sprint(value)
+	}
+}
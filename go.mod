@@ -1,3 +1,5 @@
 module ruzta
 
-go 1.25.5
\ No newline at end of file
+go 1.25.5
+
+require golang.org/x/text v0.40.0
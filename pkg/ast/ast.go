@@ -0,0 +1,59 @@
+// Package ast declares the syntax tree of Ruzta source files.
+//
+// Every node records the span of source it was parsed from, taken from the
+// spans of its first and last tokens. Declarations carry the doc comment the
+// tokenizer attached to their keyword token.
+package ast
+
+import "ruzta/pkg/tokenizer"
+
+// Node is implemented by every node of the tree.
+type Node interface {
+	Span() tokenizer.Span
+}
+
+// Decl is a declaration: a member of a file, module, class or trait.
+type Decl interface {
+	Node
+	declNode()
+}
+
+// Stmt is a statement inside a function body or block.
+type Stmt interface {
+	Node
+	stmtNode()
+}
+
+// Expr is an expression. Types are written as expressions too.
+type Expr interface {
+	Node
+	exprNode()
+}
+
+// Base holds the span of a node and is embedded in all of them.
+type Base struct {
+	Range tokenizer.Span
+}
+
+func (b Base) Span() tokenizer.Span {
+	return b.Range
+}
+
+// TokenSpan returns the span from the start of first to the end of last.
+func TokenSpan(first, last tokenizer.Token) tokenizer.Span {
+	return tokenizer.Span{File: first.Span.File, Start: first.Span.Start, End: last.Span.End}
+}
+
+// NodeSpan returns the span from the start of first to the end of last.
+func NodeSpan(first, last Node) tokenizer.Span {
+	start, end := first.Span(), last.Span()
+	return tokenizer.Span{File: start.File, Start: start.Start, End: end.End}
+}
+
+// File is a whole source file. A file is a class by default, so its members
+// are those of a class body.
+type File struct {
+	Base
+	Name    string // As passed to the tokenizer with SetFileName.
+	Members []Decl
+}
@@ -0,0 +1,18 @@
+package ast
+
+import (
+	"testing"
+
+	"ruzta/pkg/tokenizer"
+)
+
+func TestNamesAreNormalized(t *testing.T) {
+	// "e" followed by a combining acute accent normalizes to "é".
+	tokens, _ := tokenizer.Tokenize("@cafe\u0301 var cafe\u0301")
+	if got := NewAnnotation(tokens[0]).Name; got != "café" {
+		t.Errorf("annotation name = %+q, want %+q", got, "café")
+	}
+	if got := NewIdent(tokens[2]).Name; got != "café" {
+		t.Errorf("identifier name = %+q, want %+q", got, "café")
+	}
+}
@@ -0,0 +1,165 @@
+package ast
+
+import (
+	"strings"
+
+	"ruzta/pkg/tokenizer"
+)
+
+// Annotation is "@name" or "@name(args...)" applied to the declaration or
+// statement that follows it.
+type Annotation struct {
+	Base
+	Name string // Without the "@".
+	Args []Expr
+}
+
+// AnnotatedBlock applies annotations to every member of a block, as in
+// "@feature("net") { ... }". Inside a function body the same form is an
+// AnnotatedStmt.
+type AnnotatedBlock struct {
+	Base
+	Annotations []*Annotation
+	Members     []Decl
+}
+
+// ModDecl is "mod Name { ... }". Modules hold classes, traits and other
+// modules.
+type ModDecl struct {
+	Base
+	Doc         string
+	Annotations []*Annotation
+	Name        *Ident
+	Members     []Decl
+}
+
+// ClassDecl is "class Name extends Parent { ... }". Extends is nil without
+// a parent class.
+type ClassDecl struct {
+	Base
+	Doc         string
+	Annotations []*Annotation
+	Name        *Ident
+	Extends     Expr
+	Members     []Decl
+}
+
+// TraitDecl is "trait Name { ... }". Functions of a trait may have no body.
+type TraitDecl struct {
+	Base
+	Doc         string
+	Annotations []*Annotation
+	Name        *Ident
+	Members     []Decl
+}
+
+// UsesDecl is "uses A, B", which mixes the traits into the enclosing class
+// or trait.
+type UsesDecl struct {
+	Base
+	Traits []Expr
+}
+
+// Param is a function or signal parameter. Type and Default are nil when
+// left out.
+type Param struct {
+	Base
+	Name    *Ident
+	Type    Expr
+	Default Expr
+}
+
+// FuncDecl is "fn name(params) Type { ... }". ReturnType is nil when left
+// out and Body is nil for a function without a body in a trait.
+type FuncDecl struct {
+	Base
+	Doc         string
+	Annotations []*Annotation
+	Name        *Ident
+	Params      []*Param
+	ReturnType  Expr
+	Body        *BlockStmt
+}
+
+// VarDecl is a "var" or "const" declaration, as a member or a statement.
+//
+//	var x Int = 3  Type and Value set
+//	var x = 3      Type inferred from Value
+//	var x := 3     Variant set, the variable holds any type
+//	var x          neither, the variable holds any type
+type VarDecl struct {
+	Base
+	Doc         string
+	Annotations []*Annotation
+	Const       bool
+	Name        *Ident
+	Type        Expr
+	Variant     bool
+	Value       Expr
+}
+
+// SignalDecl is "signal name(params)".
+type SignalDecl struct {
+	Base
+	Doc         string
+	Annotations []*Annotation
+	Name        *Ident
+	Params      []*Param
+}
+
+// EnumDecl is "enum Name { A, B = 2 }". Name is nil for an unnamed enum.
+type EnumDecl struct {
+	Base
+	Doc         string
+	Annotations []*Annotation
+	Name        *Ident
+	Values      []*EnumValue
+}
+
+// EnumValue is one value of an enum. Value is nil when left out.
+type EnumValue struct {
+	Base
+	Name  *Ident
+	Value Expr
+}
+
+// ImportDecl is `import "path"/mod.Class.Inner as alias`. Names holds the
+// names after the path and Alias is nil when left out.
+type ImportDecl struct {
+	Base
+	Path  *Literal
+	Names []*Ident
+	Alias *Ident
+}
+
+// TypeAliasDecl is "type Target as Alias".
+type TypeAliasDecl struct {
+	Base
+	Target Expr
+	Alias  *Ident
+}
+
+// NewAnnotation returns the annotation for an ANNOTATION token, without
+// arguments. Like an Ident, its Name is in NFC form.
+func NewAnnotation(token tokenizer.Token) *Annotation {
+	name, ok := token.Literal.(string)
+	if !ok || token.Type != tokenizer.ANNOTATION {
+		name = token.Source
+	}
+	return &Annotation{Base: Base{token.Span}, Name: strings.TrimPrefix(name, "@")}
+}
+
+func (*AnnotatedBlock) declNode() {}
+func (*ModDecl) declNode()        {}
+func (*ClassDecl) declNode()      {}
+func (*TraitDecl) declNode()      {}
+func (*UsesDecl) declNode()       {}
+func (*FuncDecl) declNode()       {}
+func (*VarDecl) declNode()        {}
+func (*SignalDecl) declNode()     {}
+func (*EnumDecl) declNode()       {}
+func (*ImportDecl) declNode()     {}
+func (*TypeAliasDecl) declNode()  {}
+
+// Local variables and constants are statements as well.
+func (*VarDecl) stmtNode() {}
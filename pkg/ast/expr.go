@@ -0,0 +1,163 @@
+package ast
+
+import "ruzta/pkg/tokenizer"
+
+// Ident is a name. Name is the NFC form the tokenizer gives identifiers.
+type Ident struct {
+	Base
+	Name string
+}
+
+// Literal is a literal value as scanned by the tokenizer: nil, a bool,
+// int64, *big.Int, float64, string, tokenizer.StringNameLiteral or
+// tokenizer.NodePathLiteral.
+type Literal struct {
+	Base
+	Value      interface{}
+	NumberKind tokenizer.NumberKind
+}
+
+// InterpolatedString is f"text {expr} text". Texts holds the literal values
+// of the INTERPOLATION_START, MIDDLE and END fragments, so it always has one
+// more element than Exprs and Exprs[i] sits between Texts[i] and Texts[i+1].
+type InterpolatedString struct {
+	Base
+	Texts []string
+	Exprs []Expr
+}
+
+// Constant is PI, TAU, INF or NAN, as given by Tok.
+type Constant struct {
+	Base
+	Tok tokenizer.TokenType
+}
+
+// SelfExpr is "self".
+type SelfExpr struct {
+	Base
+}
+
+// Wildcard is "_" as a match pattern.
+type Wildcard struct {
+	Base
+}
+
+// NodeReference is $Path/To/Node, the shorthand for a get_node call.
+type NodeReference struct {
+	Base
+	Path tokenizer.NodePathLiteral
+}
+
+// ParenExpr is "(x)".
+type ParenExpr struct {
+	Base
+	X Expr
+}
+
+// UnaryExpr is a prefix operation such as "-x", "!x" or "not x".
+type UnaryExpr struct {
+	Base
+	Op tokenizer.TokenType
+	X  Expr
+}
+
+// BinaryExpr is "x op y". "x is T" and "x as T" are binary expressions with
+// the type as Y.
+type BinaryExpr struct {
+	Base
+	X  Expr
+	Op tokenizer.TokenType
+	Y  Expr
+}
+
+// CallExpr is "fun(args)", including method calls, where Fun is a
+// *MemberExpr, and "Type.new()".
+type CallExpr struct {
+	Base
+	Fun  Expr
+	Args []Expr
+}
+
+// MemberExpr is "x.name".
+type MemberExpr struct {
+	Base
+	X    Expr
+	Name *Ident
+}
+
+// IndexExpr is "x[index]".
+type IndexExpr struct {
+	Base
+	X     Expr
+	Index Expr
+}
+
+// ArrayLit is "[a, b, c]".
+type ArrayLit struct {
+	Base
+	Elems []Expr
+}
+
+// DictLit is "{key: value, ...}".
+type DictLit struct {
+	Base
+	Entries []*DictEntry
+}
+
+// DictEntry is one "key: value" pair of a DictLit.
+type DictEntry struct {
+	Base
+	Key   Expr
+	Value Expr
+}
+
+// BuilderExpr is the builder constructor "Type { new(...); prop = expr;
+// ChildType { ... } }". Body holds, in order, the "new" call as an
+// *ExprStmt, property assignments as *AssignStmt and children, added with
+// add_child, as *ExprStmt holding another *BuilderExpr.
+type BuilderExpr struct {
+	Base
+	Type Expr
+	Body []Stmt
+}
+
+// TypeExpr is a type with parameters, such as "array[int]" or
+// "dict[string, int]". A plain type is just its name expression.
+type TypeExpr struct {
+	Base
+	Name   Expr
+	Params []Expr
+}
+
+// NewIdent returns the identifier for an IDENTIFIER token, or any keyword
+// token used as a name.
+func NewIdent(token tokenizer.Token) *Ident {
+	name, ok := token.Literal.(string)
+	if !ok || token.Type != tokenizer.IDENTIFIER {
+		name = token.Source
+	}
+	return &Ident{Base: Base{token.Span}, Name: name}
+}
+
+// NewLiteral returns the literal for a LITERAL token.
+func NewLiteral(token tokenizer.Token) *Literal {
+	return &Literal{Base: Base{token.Span}, Value: token.Literal, NumberKind: token.NumberKind}
+}
+
+func (*Ident) exprNode()              {}
+func (*Literal) exprNode()            {}
+func (*InterpolatedString) exprNode() {}
+func (*Constant) exprNode()           {}
+func (*SelfExpr) exprNode()           {}
+func (*Wildcard) exprNode()           {}
+func (*NodeReference) exprNode()      {}
+func (*ParenExpr) exprNode()          {}
+func (*UnaryExpr) exprNode()          {}
+func (*BinaryExpr) exprNode()         {}
+func (*CallExpr) exprNode()           {}
+func (*MemberExpr) exprNode()         {}
+func (*IndexExpr) exprNode()          {}
+func (*ArrayLit) exprNode()           {}
+func (*DictLit) exprNode()            {}
+func (*BuilderExpr) exprNode()        {}
+func (*TypeExpr) exprNode()           {}
@@ -0,0 +1,107 @@
+package ast
+
+import "ruzta/pkg/tokenizer"
+
+// BlockStmt is "{ ... }", which always opens a scope.
+type BlockStmt struct {
+	Base
+	Stmts []Stmt
+}
+
+// AnnotatedStmt applies annotations to one statement inside a function
+// body, as in "@feature("net") send(x)". An annotated "{ ... }" block is an
+// AnnotatedStmt holding a *BlockStmt.
+type AnnotatedStmt struct {
+	Base
+	Annotations []*Annotation
+	Stmt        Stmt
+}
+
+// ExprStmt is an expression used as a statement, such as a call.
+type ExprStmt struct {
+	Base
+	X Expr
+}
+
+// AssignStmt is "target = value" or a compound assignment such as "+=".
+// Op is the assignment token type, EQUAL for a plain assignment.
+type AssignStmt struct {
+	Base
+	Target Expr
+	Op     tokenizer.TokenType
+	Value  Expr
+}
+
+// IfStmt is "if (cond) { ... } elif (cond) { ... } else { ... }". Else is
+// nil without an else branch.
+type IfStmt struct {
+	Base
+	Cond  Expr
+	Then  *BlockStmt
+	Elifs []*ElifClause
+	Else  *BlockStmt
+}
+
+// ElifClause is one "elif (cond) { ... }" branch of an IfStmt.
+type ElifClause struct {
+	Base
+	Cond Expr
+	Body *BlockStmt
+}
+
+// WhileStmt is "while (cond) { ... }".
+type WhileStmt struct {
+	Base
+	Cond Expr
+	Body *BlockStmt
+}
+
+// ForStmt is "for x in iter { ... }". Type is nil unless the variable is
+// typed, as in "for x Int in iter".
+type ForStmt struct {
+	Base
+	Var  *Ident
+	Type Expr
+	Iter Expr
+	Body *BlockStmt
+}
+
+// MatchStmt is "match (subject) { cases }". The first case whose pattern
+// matches and whose guard holds runs, there is no fallthrough.
+type MatchStmt struct {
+	Base
+	Subject Expr
+	Cases   []*MatchCase
+}
+
+// MatchCase is "1, 2 when guard { ... }". A "_" pattern is a *Wildcard and
+// Guard is nil without "when".
+type MatchCase struct {
+	Base
+	Patterns []Expr
+	Guard    Expr
+	Body     *BlockStmt
+}
+
+// ReturnStmt is "return" with an optional Value.
+type ReturnStmt struct {
+	Base
+	Value Expr
+}
+
+// BranchStmt is "break", "continue" or "pass", as given by Tok.
+type BranchStmt struct {
+	Base
+	Tok tokenizer.TokenType
+}
+
+func (*BlockStmt) stmtNode()     {}
+func (*AnnotatedStmt) stmtNode() {}
+func (*ExprStmt) stmtNode()      {}
+func (*AssignStmt) stmtNode()    {}
+func (*IfStmt) stmtNode()        {}
+func (*WhileStmt) stmtNode()     {}
+func (*ForStmt) stmtNode()       {}
+func (*MatchStmt) stmtNode()     {}
+func (*ReturnStmt) stmtNode()    {}
+func (*BranchStmt) stmtNode()    {}
@@ -0,0 +1,124 @@
+package tokenizer
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+type ColumnEncoding int
+
+const (
+	COLUMN_VISUAL ColumnEncoding = iota // Tabs advance to the tab size.
+	COLUMN_RUNE
+	COLUMN_UTF16 // UTF-16 code units, as used by LSP.
+	COLUMN_BYTE
+)
+
+// columnWidth returns how many columns c takes up in encoding.
+func columnWidth(c rune, encoding ColumnEncoding, tabSize int) int {
+	switch encoding {
+	case COLUMN_VISUAL:
+		if c == '\t' {
+			return tabSize
+		}
+		return 1
+	case COLUMN_UTF16:
+		if c >= 0x10000 {
+			return 2
+		}
+		return 1
+	case COLUMN_BYTE:
+		return utf8.RuneLen(c)
+	default:
+		return 1
+	}
+}
+
+// LineMap converts positions in a source text between column encodings.
+type LineMap struct {
+	source     string
+	lineStarts []int
+	tabSize    int
+}
+
+// NewLineMap indexes the lines of src. tabSize is used for visual columns
+// and should match the tokenizer that produced the spans. Like the tokenizer,
+// it doesn't count a byte order mark at the start as a column, and raises
+// tab sizes below 1 to 1.
+func NewLineMap(src string, tabSize int) *LineMap {
+	m := &LineMap{source: src, lineStarts: []int{0}, tabSize: max(tabSize, 1)}
+	if strings.HasPrefix(src, string(rune(byteOrderMark))) {
+		m.lineStarts[0] = len(string(rune(byteOrderMark)))
+	}
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\n' {
+			m.lineStarts = append(m.lineStarts, i+1)
+		}
+	}
+	return m
+}
+
+// line returns the byte offset where line starts and its text, including
+// the line break. Lines out of range are clamped.
+func (m *LineMap) line(line int) (int, string) {
+	line = max(1, min(line, len(m.lineStarts)))
+	start, end := m.lineStarts[line-1], len(m.source)
+	if line < len(m.lineStarts) {
+		end = m.lineStarts[line]
+	}
+	return start, m.source[start:end]
+}
+
+// Column returns the column of pos counted in encoding.
+func (m *LineMap) Column(pos Position, encoding ColumnEncoding) int {
+	start, text := m.line(pos.Line)
+	column := 1
+	for i := 0; i < len(text) && start+i < pos.Offset; {
+		c, size := utf8.DecodeRuneInString(text[i:])
+		if encoding == COLUMN_BYTE {
+			column += size
+		} else {
+			column += columnWidth(c, encoding, m.tabSize)
+		}
+		i += size
+	}
+	return column
+}
+
+// SpanColumns returns the start and end columns of span counted in encoding.
+func (m *LineMap) SpanColumns(span Span, encoding ColumnEncoding) (int, int) {
+	return m.Column(span.Start, encoding), m.Column(span.End, encoding)
+}
+
+// Position returns the position of column on line, counted in encoding.
+// A column inside a tab or a multi-unit character resolves to its start and
+// one past the end of the line to the line break.
+func (m *LineMap) Position(line, column int, encoding ColumnEncoding) Position {
+	start, text := m.line(line)
+	pos := Position{Offset: start, Line: max(1, min(line, len(m.lineStarts))), Column: 1, UTF16Column: 1}
+	at := 1
+	for i := 0; i < len(text); {
+		c, size := utf8.DecodeRuneInString(text[i:])
+		if c == '\n' {
+			break
+		}
+		width := columnWidth(c, encoding, m.tabSize)
+		if encoding == COLUMN_BYTE {
+			width = size
+		}
+		if at+width > column {
+			break
+		}
+		at += width
+		pos.Offset += size
+		pos.Column++
+		pos.UTF16Column += columnWidth(c, COLUMN_UTF16, m.tabSize)
+		i += size
+	}
+	return pos
+}
+
+// ConvertColumn converts a column on line from one encoding to another.
+func (m *LineMap) ConvertColumn(line, column int, from, to ColumnEncoding) int {
+	return m.Column(m.Position(line, column, from), to)
+}
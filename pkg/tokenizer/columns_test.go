@@ -0,0 +1,27 @@
+package tokenizer
+
+import "testing"
+
+func TestTabSize(t *testing.T) {
+	tests := []struct {
+		size int
+		want int // Visual column of "x" after a tab.
+	}{
+		{4, 5},
+		{8, 9},
+		{1, 2},
+		{0, 2},
+		{-3, 2},
+	}
+	for _, test := range tests {
+		tokenizer := NewTokenizer("\tx")
+		tokenizer.SetTabSize(test.size)
+		if got := tokenizer.Scan().StartColumn; got != test.want {
+			t.Errorf("tab size %d: StartColumn = %d, want %d", test.size, got, test.want)
+		}
+		m := NewLineMap("\tx", test.size)
+		if got := m.Column(Position{Offset: 1, Line: 1}, COLUMN_VISUAL); got != test.want {
+			t.Errorf("tab size %d: LineMap column = %d, want %d", test.size, got, test.want)
+		}
+	}
+}
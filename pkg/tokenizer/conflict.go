@@ -0,0 +1,164 @@
+package tokenizer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ConflictResolution selects what is scanned of a region left by a version
+// control merge conflict:
+//
+//	<<<<<<< ours
+//	...
+//	||||||| base
+//	...
+//	=======
+//	...
+//	>>>>>>> theirs
+//
+// The base section is optional. Whatever is not scanned, including the
+// markers, becomes TRIVIA_CONFLICT.
+type ConflictResolution int
+
+const (
+	CONFLICT_SKIP   ConflictResolution = iota // Neither side.
+	CONFLICT_OURS                             // The side after "<<<<<<<".
+	CONFLICT_THEIRS                           // The side after "=======".
+)
+
+// conflictMarkerLength is the length of the markers git writes.
+const conflictMarkerLength = 7
+
+// SetConflictResolution selects which side of a conflict region is scanned.
+// The default is CONFLICT_SKIP.
+func (t *Tokenizer) SetConflictResolution(resolution ConflictResolution) {
+	t.conflicts = resolution
+}
+
+// skipConflict skips the part of a conflict region that starts at the
+// current position, if any, and reports whether it did. A whole region is
+// reported once when its opening marker is reached. Markers outside of a
+// complete region are left for checkVCSMarker.
+func (t *Tokenizer) skipConflict() bool {
+	if t.offset() != t.lineOffset {
+		return false
+	}
+	switch {
+	case t.inConflict && t.conflicts == CONFLICT_OURS && (t.markerAt(t._current, '|') || t.markerAt(t._current, '=')):
+		// Skip the base and their side.
+		end := t.findMarker(t._current, '>')
+		if end < 0 {
+			return false
+		}
+		t.skipConflictLines(t.lineEnd(end))
+		t.inConflict = false
+		return true
+
+	case t.inConflict && t.conflicts == CONFLICT_THEIRS && t.markerAt(t._current, '>'):
+		t.skipConflictLines(t.lineEnd(t._current))
+		t.inConflict = false
+		return true
+
+	case !t.inConflict && t.markerAt(t._current, '<'):
+		middle := t.findMarker(t._current, '=')
+		if middle < 0 {
+			return false
+		}
+		end := t.findMarker(middle, '>')
+		if end < 0 {
+			return false
+		}
+		ours, theirs := t.conflictLabel(t._current, "ours"), t.conflictLabel(end, "theirs")
+		start := t.pos()
+		t.skipConflictLines(t.lineEnd(t._current))
+		t.report(Span{File: t.file, Start: start, End: t.pos()}, SEVERITY_ERROR, ERR_MERGE_CONFLICT,
+			fmt.Sprintf("Unresolved merge conflict between %q and %q.", ours, theirs))
+
+		switch t.conflicts {
+		case CONFLICT_OURS:
+			t.inConflict = true
+		case CONFLICT_THEIRS:
+			t.skipConflictLines(t.lineEnd(middle))
+			t.inConflict = true
+		default:
+			t.skipConflictLines(t.lineEnd(end))
+		}
+		return true
+	}
+	return false
+}
+
+// markerAt reports whether a conflict marker made of c starts at idx. It
+// must be followed by a space or the end of the line.
+func (t *Tokenizer) markerAt(idx int, c byte) bool {
+	for i := range conflictMarkerLength {
+		if !t.ensure(idx+i) || t.source[idx+i] != c {
+			return false
+		}
+	}
+	if !t.ensure(idx + conflictMarkerLength) {
+		return true
+	}
+	switch t.source[idx+conflictMarkerLength] {
+	case ' ', '\t', '\r', '\n':
+		return true
+	}
+	return false
+}
+
+// findMarker returns the index of the first line after the one at idx that
+// starts with a conflict marker made of c, or -1. It gives up at the start
+// of another region.
+func (t *Tokenizer) findMarker(idx int, c byte) int {
+	for {
+		idx = t.lineEnd(idx) + 1
+		if !t.ensure(idx) {
+			return -1
+		}
+		if t.markerAt(idx, c) {
+			return idx
+		}
+		if t.markerAt(idx, '<') {
+			return -1
+		}
+	}
+}
+
+// lineEnd returns the index of the line break ending the line at idx, or
+// the end of the source.
+func (t *Tokenizer) lineEnd(idx int) int {
+	for t.ensure(idx) && t.source[idx] != '\n' {
+		if i := strings.IndexByte(t.source[idx:], '\n'); i >= 0 {
+			return idx + i
+		}
+		idx = len(t.source)
+	}
+	return idx
+}
+
+// conflictLabel returns the text after the marker at idx, usually a branch
+// name, or fallback if there is none.
+func (t *Tokenizer) conflictLabel(idx int, fallback string) string {
+	label := strings.TrimSpace(t.source[idx+conflictMarkerLength : t.lineEnd(idx)])
+	if label == "" {
+		return fallback
+	}
+	return label
+}
+
+// skipConflictLines skips up to end, which must not be before the current
+// position, counting the lines on the way.
+func (t *Tokenizer) skipConflictLines(end int) {
+	for t._current < end {
+		if t.advance() == '\n' {
+			t.newline(false)
+		}
+	}
+}
+
+// hasConflictRegion reports whether a line of src starts with an opening
+// conflict marker.
+func hasConflictRegion(src string) bool {
+	marker := strings.Repeat("<", conflictMarkerLength)
+	return strings.HasPrefix(src, marker) || strings.Contains(src, "\n"+marker)
+}
@@ -0,0 +1,38 @@
+package tokenizer
+
+import "testing"
+
+func TestConflictMarkers(t *testing.T) {
+	tests := []struct {
+		src     string
+		markers int // VCS_CONFLICT_MARKER tokens.
+		errors  int // ERR_MERGE_CONFLICT diagnostics.
+	}{
+		{"a <<<<<<< b\n", 1, 1},
+		{">>>>>>> theirs\n", 1, 1},
+		{"=======\n", 1, 1},
+		{"<<<<<<< ours\nvar a = 1\n", 1, 1},
+		{"<<<<<<< ours\nvar a = 1\n=======\nvar a = 2\n", 2, 2},
+		{"<<<<<<< ours\nvar a = 1\n=======\nvar a = 2\n>>>>>>> theirs\n", 0, 1},
+		{"a << b == c >> d\n", 0, 0},
+	}
+	for _, test := range tests {
+		tokenizer := NewTokenizer(test.src)
+		markers := 0
+		for token := range tokenizer.Tokens() {
+			if token.Type == VCS_CONFLICT_MARKER {
+				markers++
+			}
+		}
+		errors := 0
+		for _, d := range tokenizer.Diagnostics() {
+			if d.Code == ERR_MERGE_CONFLICT {
+				errors++
+			}
+		}
+		if markers != test.markers || errors != test.errors || tokenizer.HasErrors() != (test.errors > 0) {
+			t.Errorf("%q: %d markers and %d errors (HasErrors %v), want %d and %d",
+				test.src, markers, errors, tokenizer.HasErrors(), test.markers, test.errors)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package tokenizer
+
+import "fmt"
+
+type Severity int
+
+const (
+	SEVERITY_ERROR Severity = iota
+	SEVERITY_WARNING
+	SEVERITY_NOTE
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SEVERITY_ERROR:
+		return "error"
+	case SEVERITY_WARNING:
+		return "warning"
+	case SEVERITY_NOTE:
+		return "note"
+	default:
+		return "unknown"
+	}
+}
+
+// DiagnosticCode is a stable identifier for a kind of problem, so tools can
+// filter or look up documentation without matching on the message.
+type DiagnosticCode string
+
+const (
+	ERR_INVALID_CHARACTER        DiagnosticCode = "E0001"
+	ERR_STRAY_CARRIAGE_RETURN    DiagnosticCode = "E0002"
+	ERR_UNTERMINATED_COMMENT     DiagnosticCode = "E0003"
+	ERR_UNTERMINATED_STRING      DiagnosticCode = "E0004"
+	ERR_INVALID_NUMBER           DiagnosticCode = "E0005"
+	ERR_UNMATCHED_PAREN          DiagnosticCode = "E0006"
+	ERR_EXPECTED_ANNOTATION_NAME DiagnosticCode = "E0007"
+	ERR_INVALID_ESCAPE           DiagnosticCode = "E0008"
+	ERR_INVALID_INTERPOLATION    DiagnosticCode = "E0009"
+	ERR_INVALID_NODE_PATH        DiagnosticCode = "E0010"
+	ERR_NUMBER_OUT_OF_RANGE      DiagnosticCode = "E0011"
+	ERR_MERGE_CONFLICT           DiagnosticCode = "E0012"
+
+	WARN_MIXED_SCRIPT_IDENTIFIER DiagnosticCode = "W0001"
+	WARN_CONFUSABLE_IDENTIFIER   DiagnosticCode = "W0002"
+)
+
+// Note adds context to a diagnostic, optionally pointing at another place in
+// the source.
+type Note struct {
+	Span    Span
+	Message string
+}
+
+// SuggestedFix replaces the text covered by Span with Replacement.
+type SuggestedFix struct {
+	Message     string
+	Span        Span
+	Replacement string
+}
+
+type Diagnostic struct {
+	Code     DiagnosticCode
+	Severity Severity
+	Span     Span
+	Message  string
+	Notes    []Note
+	Fix      *SuggestedFix
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s[%s]: %s", d.Span.File, d.Span.Start.Line, d.Span.Start.Column, d.Severity, d.Code, d.Message)
+}
@@ -0,0 +1,82 @@
+package tokenizer
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		src   string
+		want  string
+		codes []DiagnosticCode
+	}{
+		{`"\n\t\r\a\b\f\v\0"`, "\n\t\r\a\b\f\v\x00", nil},
+		{`"\\ \" \'"`, `\ " '`, nil},
+		{`'\''`, "'", nil},
+		{`"\x41\x7e"`, "A~", nil},
+		{`"\xff"`, "ÿ", nil},
+		{`"\x4"`, "", []DiagnosticCode{ERR_INVALID_ESCAPE}},
+		{`"\xg1"`, "g1", []DiagnosticCode{ERR_INVALID_ESCAPE}},
+		{`"é"`, "é", nil},
+		{`"\U0001F600"`, "\U0001F600", nil},
+		{`"\U0010FFFF"`, "\U0010FFFF", nil},
+		{`"\U00110000"`, "�", []DiagnosticCode{ERR_INVALID_ESCAPE}},
+		{`"\UFFFFFFFF"`, "�", []DiagnosticCode{ERR_INVALID_ESCAPE}},
+		{`"\U0000D800"`, "�", []DiagnosticCode{ERR_INVALID_ESCAPE}},
+		{`"\U12"`, "", []DiagnosticCode{ERR_INVALID_ESCAPE}},
+		{`"😀"`, "\U0001F600", nil},
+		{`"\uD83D"`, "�", []DiagnosticCode{ERR_INVALID_ESCAPE}},
+		{`"\uD83Dx"`, "�x", []DiagnosticCode{ERR_INVALID_ESCAPE}},
+		{`"\uD83DA"`, "�A", []DiagnosticCode{ERR_INVALID_ESCAPE}},
+		{`"\uDE00"`, "�", []DiagnosticCode{ERR_INVALID_ESCAPE}},
+		{"\"a\\\nb\"", "ab", nil},
+		{"\"a\\\r\nb\"", "ab", nil},
+		{"\"a\\\rb\"", "ab", []DiagnosticCode{ERR_STRAY_CARRIAGE_RETURN}},
+		{`"\q"`, "q", []DiagnosticCode{ERR_INVALID_ESCAPE}},
+		{`r"\"\n\x41"`, `\"\n\x41`, nil},
+		{`r'\'\\'`, `\'\\`, nil},
+	}
+	for _, test := range tests {
+		tokens, diagnostics := Tokenize(test.src)
+		if tokens[0].Type != LITERAL {
+			t.Errorf("%s: got %s, want a literal", test.src, tokens[0].GetDebugName())
+			continue
+		}
+		if got, _ := tokens[0].Literal.(string); got != test.want {
+			t.Errorf("%s: Literal = %+q, want %+q", test.src, got, test.want)
+		}
+		var codes []DiagnosticCode
+		for _, d := range diagnostics {
+			codes = append(codes, d.Code)
+		}
+		if len(codes) != len(test.codes) || (len(codes) > 0 && codes[0] != test.codes[0]) {
+			t.Errorf("%s: diagnostics %v, want %v", test.src, diagnostics, test.codes)
+		}
+	}
+}
+
+func TestUnterminatedStringStopsAtLineEnd(t *testing.T) {
+	tokens, diagnostics := Tokenize("var a = \"oops\nvar b = 2\nvar c = \"x\"\n")
+	var types []TokenType
+	for _, token := range tokens {
+		types = append(types, token.Type)
+	}
+	want := []TokenType{
+		VAR, IDENTIFIER, EQUAL, ERROR, NEWLINE,
+		VAR, IDENTIFIER, EQUAL, LITERAL, NEWLINE,
+		VAR, IDENTIFIER, EQUAL, LITERAL, NEWLINE, EOF,
+	}
+	if !slices.Equal(types, want) {
+		t.Errorf("got %v, want %v", types, want)
+	}
+	if len(diagnostics) != 1 || diagnostics[0].Code != ERR_UNTERMINATED_STRING {
+		t.Fatalf("diagnostics %v, want one %s", diagnostics, ERR_UNTERMINATED_STRING)
+	}
+	if span := diagnostics[0].Span; span.Start.Line != 1 || span.Start.Column != 9 || span.End.Line != 1 {
+		t.Errorf("error at %+v, want 1:9 to the end of line 1", span)
+	}
+	if got := tokens[3].Source; got != `"oops` {
+		t.Errorf("error token covers %q, want %q", got, `"oops`)
+	}
+}
@@ -0,0 +1,225 @@
+package tokenizer
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// isUnicodeIdentifierStart reports whether r can start an identifier: an
+// underscore or a character with the XID_Start property of UAX #31.
+func isUnicodeIdentifierStart(r rune) bool {
+	if r < utf8.RuneSelf {
+		return r == '_' || ('a' <= r|0x20 && r|0x20 <= 'z')
+	}
+	return unicode.In(r, unicode.L, unicode.Nl, unicode.Other_ID_Start) &&
+		!unicode.In(r, unicode.Pattern_Syntax, unicode.Pattern_White_Space) &&
+		!notXIDStart(r)
+}
+
+// isUnicodeIdentifierContinue reports whether r can continue an identifier,
+// that is whether it has the XID_Continue property of UAX #31.
+func isUnicodeIdentifierContinue(r rune) bool {
+	if r < utf8.RuneSelf {
+		return r == '_' || isDigit(r) || ('a' <= r|0x20 && r|0x20 <= 'z')
+	}
+	return unicode.In(r, unicode.L, unicode.Nl, unicode.Other_ID_Start,
+		unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc, unicode.Other_ID_Continue) &&
+		!unicode.In(r, unicode.Pattern_Syntax, unicode.Pattern_White_Space) &&
+		!notXIDContinue(r)
+}
+
+// notXIDStart reports whether r has ID_Start but not XID_Start, which leaves
+// out the few characters whose NFKC form can't start an identifier.
+func notXIDStart(r rune) bool {
+	switch r {
+	case 0x0E33, 0x0EB3, 0xFF9E, 0xFF9F:
+		return true
+	}
+	return notXIDContinue(r)
+}
+
+// notXIDContinue reports whether r has ID_Continue but not XID_Continue.
+func notXIDContinue(r rune) bool {
+	switch {
+	case r == 0x037A, r == 0x309B, r == 0x309C, r == 0xFDFA, r == 0xFDFB:
+		return true
+	case r >= 0xFC5E && r <= 0xFC63:
+		return true
+	case r >= 0xFE70 && r <= 0xFE7E:
+		return r%2 == 0
+	}
+	return false
+}
+
+// sighting is the first name seen with a given skeleton.
+type sighting struct {
+	name string
+	span Span
+}
+
+// checkIdentifier warns about the first occurrence of a name that mixes
+// writing systems or can be mistaken for a keyword or for another name, as
+// described in UTS #39. name is the normalized spelling.
+//
+// ASCII names are all Latin and their own skeleton, so they are found in
+// names. Only the other names are kept in sightings, by skeleton.
+func (t *Tokenizer) checkIdentifier(token *Token, name string) {
+	first, ok := t.sightings[name]
+	if !isASCII(name) {
+		if scripts := identifierScripts(name); !scriptsMix(scripts) {
+			t.report(token.Span, SEVERITY_WARNING, WARN_MIXED_SCRIPT_IDENTIFIER,
+				fmt.Sprintf("Identifier \"%s\" mixes the %s scripts.", name, strings.Join(scripts, " and ")))
+		}
+		key := skeleton(name)
+		if key != name && lookupKeyword(key) != nil {
+			t.report(token.Span, SEVERITY_WARNING, WARN_CONFUSABLE_IDENTIFIER,
+				fmt.Sprintf("Identifier \"%s\" looks like the keyword \"%s\".", name, key))
+			return
+		}
+		first, ok = t.sightings[key]
+		if i := t.findName(key); !ok && t.names[i] != 0 && isASCII(key) {
+			// An ASCII name ends as many columns after its start as it has
+			// bytes.
+			start := t.name(int(t.names[i]) - 1).start
+			end := start
+			end.Offset += len(key)
+			end.Column += len(key)
+			end.UTF16Column += len(key)
+			first, ok = sighting{name: key, span: Span{File: t.file, Start: start, End: end}}, true
+		}
+		if !ok {
+			if t.sightings == nil {
+				t.sightings = make(map[string]sighting)
+			}
+			t.sightings[key] = sighting{name: name, span: token.Span}
+			return
+		}
+	}
+	if ok && first.name != name {
+		t.report(token.Span, SEVERITY_WARNING, WARN_CONFUSABLE_IDENTIFIER,
+			fmt.Sprintf("Identifier \"%s\" looks like \"%s\".", name, first.name))
+		diagnostic := t.lastDiagnostic()
+		diagnostic.Notes = append(diagnostic.Notes, Note{Span: first.span, Message: fmt.Sprintf("\"%s\" is used here.", first.name)})
+	}
+}
+
+// identifierScripts returns the scripts used in name in order of appearance,
+// leaving out the Common and Inherited ones shared by all scripts.
+func identifierScripts(name string) []string {
+	var scripts []string
+	for _, c := range name {
+		script := "Latin"
+		if c >= utf8.RuneSelf {
+			script = scriptOf(c)
+		} else if !('a' <= c|0x20 && c|0x20 <= 'z') {
+			continue
+		}
+		switch script {
+		case "", "Common", "Inherited":
+			continue
+		}
+		seen := false
+		for _, s := range scripts {
+			seen = seen || s == script
+		}
+		if !seen {
+			scripts = append(scripts, script)
+		}
+	}
+	return scripts
+}
+
+func scriptOf(c rune) string {
+	for name, table := range unicode.Scripts {
+		if unicode.Is(table, c) {
+			return name
+		}
+	}
+	return ""
+}
+
+// scriptCombinations are the sets of scripts commonly written together,
+// following the highly restrictive level of UTS #39.
+var scriptCombinations = [][]string{
+	{"Latin", "Han", "Hiragana", "Katakana"},
+	{"Latin", "Han", "Bopomofo"},
+	{"Latin", "Han", "Hangul"},
+}
+
+// scriptsMix reports whether scripts may appear together in one identifier.
+func scriptsMix(scripts []string) bool {
+	if len(scripts) <= 1 {
+		return true
+	}
+	for _, combination := range scriptCombinations {
+		all := true
+		for _, script := range scripts {
+			found := false
+			for _, allowed := range combination {
+				found = found || allowed == script
+			}
+			all = all && found
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+// skeleton maps the characters of name that are easily mistaken for an ASCII
+// letter or digit to that character, so names that look alike compare equal.
+// This covers the common Cyrillic and Greek lookalikes and the fullwidth
+// forms rather than the whole UTS #39 confusables table.
+func skeleton(name string) string {
+	if isASCII(name) {
+		return name
+	}
+	var b strings.Builder
+	b.Grow(len(name))
+	for _, c := range name {
+		switch {
+		case c >= 0xFF10 && c <= 0xFF19:
+			c = '0' + c - 0xFF10
+		case c >= 0xFF21 && c <= 0xFF3A:
+			c = 'A' + c - 0xFF21
+		case c >= 0xFF41 && c <= 0xFF5A:
+			c = 'a' + c - 0xFF41
+		case c == 0xFF3F:
+			c = '_'
+		default:
+			if lookalike, ok := confusables[c]; ok {
+				c = lookalike
+			}
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'B', 'е': 'e', 'һ': 'h', 'і': 'i', 'ј': 'j', 'к': 'k', 'м': 'M',
+	'н': 'H', 'о': 'o', 'р': 'p', 'с': 'c', 'т': 'T', 'у': 'y', 'х': 'x', 'ѕ': 's',
+	'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'ӏ': 'l', 'ү': 'y',
+	'А': 'A', 'В': 'B', 'Е': 'E', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O', 'Р': 'P',
+	'С': 'C', 'Т': 'T', 'Х': 'X', 'У': 'Y', 'Ѕ': 'S', 'І': 'I', 'Ј': 'J', 'Ԛ': 'Q',
+	'Ԝ': 'W', 'Ү': 'Y', 'Ӏ': 'I', 'З': '3', 'Ь': 'b',
+	// Greek
+	'α': 'a', 'ι': 'i', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'υ': 'u',
+	'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I', 'Κ': 'K', 'Μ': 'M',
+	'Ν': 'N', 'Ο': 'O', 'Ρ': 'P', 'Τ': 'T', 'Υ': 'Y', 'Χ': 'X',
+	// Latin
+	'ı': 'i', 'ɡ': 'g', 'ɑ': 'a', 'ǀ': 'l',
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
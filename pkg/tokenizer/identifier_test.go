@@ -0,0 +1,97 @@
+package tokenizer
+
+import "testing"
+
+func TestIdentifierNormalization(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"caf\u00e9", "caf\u00e9"},
+		{"cafe\u0301", "caf\u00e9"},
+		{"a\u0323\u0307", "\u1ea1\u0307"},
+		{"\u0227\u0323", "\u1ea1\u0307"},
+		{"\u1100\u1161\u11a8", "\uac01"},
+		{"\u00c5\u0301", "\u01fa"},
+		{"\u0915\u093c", "\u0915\u093c"}, // Excluded from composition.
+		{"plain_name1", "plain_name1"},
+	}
+	for _, test := range tests {
+		tokens, _ := Tokenize(test.src)
+		if tokens[0].Type != IDENTIFIER {
+			t.Errorf("%+q: got %s, want an identifier", test.src, tokens[0].GetDebugName())
+			continue
+		}
+		if tokens[0].Source != test.src {
+			t.Errorf("%+q: Source = %+q, want the spelling as written", test.src, tokens[0].Source)
+		}
+		if tokens[0].Literal != test.want {
+			t.Errorf("%+q: Literal = %+q, want %+q", test.src, tokens[0].Literal, test.want)
+		}
+	}
+}
+
+func TestIdentifierCharacters(t *testing.T) {
+	tests := []struct {
+		r             rune
+		start, inside bool
+	}{
+		{'a', true, true},
+		{'_', true, true},
+		{'7', false, true},
+		{'é', true, true},
+		{'́', false, true},  // Combining acute accent.
+		{'‿', false, true},  // Undertie, connector punctuation.
+		{'Ⅰ', true, true},   // Roman numeral one, a letter number.
+		{'①', false, false}, // Circled digit one.
+		{'ͺ', false, false}, // Excluded from XID by NFKC closure.
+		{'ำ', false, true},
+		{'·', false, true},
+		{'$', false, false},
+	}
+	for _, test := range tests {
+		if got := isUnicodeIdentifierStart(test.r); got != test.start {
+			t.Errorf("isUnicodeIdentifierStart(%+q) = %v, want %v", test.r, got, test.start)
+		}
+		if got := isUnicodeIdentifierContinue(test.r); got != test.inside {
+			t.Errorf("isUnicodeIdentifierContinue(%+q) = %v, want %v", test.r, got, test.inside)
+		}
+	}
+}
+
+func TestIdentifierWarnings(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []DiagnosticCode
+	}{
+		{"count", nil},
+		{"déjà_vu", nil},
+		{"漢字かなカナ", nil},
+		{"сount", []DiagnosticCode{WARN_MIXED_SCRIPT_IDENTIFIER}},
+		{"count сount", []DiagnosticCode{WARN_MIXED_SCRIPT_IDENTIFIER, WARN_CONFUSABLE_IDENTIFIER}},
+		{"раss", []DiagnosticCode{WARN_MIXED_SCRIPT_IDENTIFIER, WARN_CONFUSABLE_IDENTIFIER}},
+		{"αβγ", nil},
+		{"ｃｏｕｎｔ count", []DiagnosticCode{WARN_CONFUSABLE_IDENTIFIER}},
+		{"сount сount", []DiagnosticCode{WARN_MIXED_SCRIPT_IDENTIFIER}},
+	}
+	for _, test := range tests {
+		_, diagnostics := Tokenize(test.src)
+		var got []DiagnosticCode
+		for _, d := range diagnostics {
+			if d.Severity != SEVERITY_WARNING {
+				t.Errorf("%q: unexpected %s", test.src, d)
+			}
+			got = append(got, d.Code)
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("%q: got %v, want %v", test.src, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%q: got %v, want %v", test.src, got, test.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package tokenizer
+
+import (
+	"reflect"
+	"strings"
+)
+
+// TextEdit replaces the bytes [Start, End) of a source with Text.
+type TextEdit struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// TokenRange is a half-open range of indexes into a token list.
+type TokenRange struct {
+	Start int
+	End   int
+}
+
+// Retokenized is the outcome of an incremental re-tokenization. Old holds
+// the indexes of the tokens in the previous list that were replaced and New
+// the indexes of their replacements in Tokens. Tokens outside of New are
+// reused from the previous list, moved to their place in the edited source.
+type Retokenized struct {
+	Tokens      []Token
+	Old         TokenRange
+	New         TokenRange
+	Diagnostics []Diagnostic // Only covers the rescanned region.
+}
+
+// Retokenize updates old, the complete token stream of a source, after edit
+// was applied to it. The tokenizer must have been created with NewTokenizer
+// for the edited source, configured like the one that produced old, and not
+// have been scanned yet.
+//
+// Scanning restarts after the last token on a line before the edit that
+// leaves no annotation, interpolated string or doc comment open. No token
+// looks past the end of its line, so nothing before that point can change.
+// Scanning stops as soon as a rescanned token past the edit matches the old
+// one at the same place with the same paren stack. Everything after it is
+// taken from old.
+func (t *Tokenizer) Retokenize(old []Token, edit TextEdit) Retokenized {
+	var replay, resume, candidateState replayState
+	restart, candidate := -1, -1
+	for i, token := range old {
+		if token.Type == EOF || token.Span.Start.Offset >= edit.Start {
+			break
+		}
+		if token.Type == NEWLINE {
+			restart, resume = candidate, candidateState
+		}
+		replay.step(token)
+		if replay.resumable(token) {
+			candidate = i
+			candidateState = replay.clone()
+		}
+	}
+	if t.conflicts != CONFLICT_SKIP && hasConflictRegion(t.source) {
+		// Which side of a region a token is on isn't recorded, so start over.
+		restart = -1
+	}
+	if restart >= 0 {
+		t.resumeAfter(old[restart], resume)
+	}
+
+	result := Retokenized{
+		Tokens: append([]Token(nil), old[:restart+1]...),
+		Old:    TokenRange{Start: restart + 1, End: len(old)},
+		New:    TokenRange{Start: restart + 1},
+	}
+	delta := len(edit.Text) - (edit.End - edit.Start)
+	replay = resume
+	next := restart + 1
+	for {
+		token := t.Scan()
+		result.Tokens = append(result.Tokens, token)
+
+		for next < len(old) && (old[next].Span.Start.Offset < edit.End ||
+			old[next].Span.Start.Offset+delta < token.Span.Start.Offset) {
+			replay.step(old[next])
+			next++
+		}
+		if next < len(old) && old[next].Span.Start.Offset+delta == token.Span.Start.Offset {
+			after := replay.clone()
+			after.step(old[next])
+			if after.resumable(old[next]) && t.matches(after) && sameToken(token, old[next]) {
+				lines := token.StartLine - old[next].StartLine
+				for _, reused := range old[next+1:] {
+					shifted := shiftToken(reused, delta, lines)
+					t.flagCursor(&shifted)
+					result.Tokens = append(result.Tokens, shifted)
+				}
+				result.Old.End = next + 1
+				result.New.End = len(result.Tokens) - len(old[next+1:])
+				break
+			}
+		}
+		if token.Type == EOF {
+			result.New.End = len(result.Tokens)
+			break
+		}
+	}
+	result.Diagnostics = t.diagnostics
+	return result
+}
+
+// resumeAfter moves the tokenizer to the end of token and its trailing
+// trivia, in the state it was in after producing it.
+func (t *Tokenizer) resumeAfter(token Token, state replayState) {
+	end := token.Span.End
+	if n := len(token.TrailingTrivia); n > 0 {
+		end = token.TrailingTrivia[n-1].Span.End
+	}
+
+	t._current = end.Offset
+	t.line = end.Line
+	t.lineOffset = strings.LastIndexByte(t.source[:end.Offset], '\n') + 1
+	if t.lineOffset == 0 && strings.HasPrefix(t.source, string(rune(byteOrderMark))) {
+		t.lineOffset = len(string(rune(byteOrderMark)))
+	}
+	column := t.byteColumn()
+	t.shifts[COLUMN_RUNE] = end.Column - column
+	t.shifts[COLUMN_UTF16] = end.UTF16Column - column
+	t.shifts[COLUMN_VISUAL] = 1 - column
+	for _, c := range t.source[t.lineOffset:end.Offset] {
+		t.shifts[COLUMN_VISUAL] += columnWidth(c, COLUMN_VISUAL, t.tabSize)
+	}
+	t.parenStack = append([]rune(nil), state.parenStack...)
+	t.lastType = token.Type
+	t.lastLine = token.EndLine
+}
+
+// matches reports whether the tokenizer is in the state described by state.
+func (t *Tokenizer) matches(state replayState) bool {
+	if len(t.parenStack) != len(state.parenStack) || len(t.interpolations) != len(state.interpolations) {
+		return false
+	}
+	for i := range t.parenStack {
+		if t.parenStack[i] != state.parenStack[i] {
+			return false
+		}
+	}
+	return t.annotationArgs == state.annotationArgs && len(t.docLines) == 0 && !t.pendingNewline && !t.inConflict
+}
+
+// sameToken reports whether a rescanned token reads exactly like an old one
+// that sat at the same place before the edit.
+func sameToken(token, old Token) bool {
+	return token.Type == old.Type &&
+		token.Source == old.Source &&
+		token.StartColumn == old.StartColumn &&
+		token.Span.Start.Column == old.Span.Start.Column &&
+		token.Span.Start.UTF16Column == old.Span.Start.UTF16Column &&
+		token.EndLine-token.StartLine == old.EndLine-old.StartLine &&
+		token.NumberKind == old.NumberKind &&
+		token.Doc == old.Doc &&
+		reflect.DeepEqual(token.Literal, old.Literal)
+}
+
+// shiftToken returns a copy of token moved by delta bytes and lines lines.
+func shiftToken(token Token, delta, lines int) Token {
+	shifted := token
+	shifted.StartLine += lines
+	shifted.EndLine += lines
+	shifted.Span = shiftSpan(token.Span, delta, lines)
+	shifted.LeadingTrivia = shiftTrivia(token.LeadingTrivia, delta, lines)
+	shifted.TrailingTrivia = shiftTrivia(token.TrailingTrivia, delta, lines)
+	shifted.CursorPosition = -1
+	shifted.CursorPlace = CURSOR_NONE
+	return shifted
+}
+
+func shiftTrivia(list []Trivia, delta, lines int) []Trivia {
+	if list == nil {
+		return nil
+	}
+	shifted := make([]Trivia, len(list))
+	for i, trivia := range list {
+		shifted[i] = trivia
+		shifted[i].Span = shiftSpan(trivia.Span, delta, lines)
+	}
+	return shifted
+}
+
+func shiftSpan(span Span, delta, lines int) Span {
+	span.Start.Offset += delta
+	span.Start.Line += lines
+	span.End.Offset += delta
+	span.End.Line += lines
+	return span
+}
+
+// replayState follows an existing token stream, keeping the part of the
+// tokenizer state that carries from one token to the next.
+type replayState struct {
+	parenStack     []rune
+	interpolations []int // Paren depth of each open interpolated string.
+	annotationArgs int
+	keepsDocs      bool // Doc comments before the last token are still pending.
+}
+
+func (s *replayState) step(token Token) {
+	switch token.Type {
+	case PARENTHESIS_OPEN:
+		s.parenStack = append(s.parenStack, '(')
+	case BRACKET_OPEN:
+		s.parenStack = append(s.parenStack, '[')
+	case BRACE_OPEN:
+		s.parenStack = append(s.parenStack, '{')
+	case INTERPOLATION_START:
+		s.parenStack = append(s.parenStack, '{')
+		s.interpolations = append(s.interpolations, len(s.parenStack))
+	case INTERPOLATION_END:
+		s.pop()
+		s.interpolations = s.interpolations[:len(s.interpolations)-1]
+	case PARENTHESIS_CLOSE, BRACKET_CLOSE, BRACE_CLOSE:
+		s.pop()
+	case ERROR:
+		// A mismatched closing paren drops the opening it was checked against,
+		// unless that is the brace of an embedded expression.
+		switch token.Source {
+		case ")", "]", "}":
+			n := len(s.interpolations)
+			if n == 0 || s.interpolations[n-1] != len(s.parenStack) {
+				s.pop()
+			}
+		}
+	}
+	// Pending doc comments survive exactly the tokens attachDoc lets through.
+	previous := s.annotationArgs
+	s.annotationArgs = nextAnnotationArgs(previous, token.Type, len(s.parenStack))
+	s.keepsDocs = previous > 0 || s.annotationArgs != 0 || token.Type == NEWLINE
+}
+
+func (s *replayState) pop() {
+	if len(s.parenStack) > 0 {
+		s.parenStack = s.parenStack[:len(s.parenStack)-1]
+	}
+}
+
+// resumable reports whether scanning can restart right after token.
+func (s *replayState) resumable(token Token) bool {
+	return token.Type != EOF && !s.keepsDocs && len(s.interpolations) == 0
+}
+
+func (s *replayState) clone() replayState {
+	return replayState{
+		parenStack:     append([]rune(nil), s.parenStack...),
+		interpolations: append([]int(nil), s.interpolations...),
+		annotationArgs: s.annotationArgs,
+		keepsDocs:      s.keepsDocs,
+	}
+}
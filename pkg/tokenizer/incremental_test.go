@@ -0,0 +1,96 @@
+package tokenizer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRetokenize(t *testing.T) {
+	const tail = "\nfn after():\n\treturn 1\n"
+	tests := []struct {
+		name      string
+		src       string
+		old, text string // The first occurrence of old is replaced by text.
+		reuse     bool   // Whether tokens after the edit must be reused.
+		conflicts ConflictResolution
+	}{
+		{"identifier", "var abc = 1" + tail, "abc", "abcd", true, CONFLICT_SKIP},
+		{"split line", "var a = 1 + 2" + tail, "+ ", "\n+ ", true, CONFLICT_SKIP},
+		{"inside string", `var s = "hello world"` + tail, "world", "there", true, CONFLICT_SKIP},
+		{"unbalance quotes", `var s = "hello" + "world"` + tail, `"hello"`, `"hello`, false, CONFLICT_SKIP},
+		{"open string", `var s = "a"` + tail, `"a"`, `"a`, false, CONFLICT_SKIP},
+		{"multiline string", "var s = \"\"\"\none\ntwo\n\"\"\"" + tail, "two", "three", true, CONFLICT_SKIP},
+		{"f-string text", `var s = f"a {x} b"` + tail, " b", " c", true, CONFLICT_SKIP},
+		{"f-string expression", `var s = f"a {x} b"` + tail, "{x}", "{x + y}", true, CONFLICT_SKIP},
+		{"f-string open brace", `var s = f"a {x} b"` + tail, "{x}", "{x", false, CONFLICT_SKIP},
+		{"f-string format", `var s = f"{x:>8}"` + tail, ">8", "<10", true, CONFLICT_SKIP},
+		{"inside block comment", "var a /* one\ntwo */ = 1" + tail, "two", "three", true, CONFLICT_SKIP},
+		{"open block comment", "var a = 1\nvar b = 2" + tail, "var b", "/* var b", false, CONFLICT_SKIP},
+		{"close block comment", "/* var a = 1\nvar b = 2 */" + tail, "*/", "", false, CONFLICT_SKIP},
+		{"nested block comment", "/* a /* b */ c */ var x" + tail, "/* b */", "/* b", false, CONFLICT_SKIP},
+		{"doc comment text", "/// Old doc.\n/// More.\nvar x" + tail, "Old", "New", true, CONFLICT_SKIP},
+		{"doc comment removed", "/// Doc.\nvar x" + tail, "/// Doc.\n", "", true, CONFLICT_SKIP},
+		{"doc comment added", "var y\nvar x" + tail, "var x", "/// Doc.\nvar x", true, CONFLICT_SKIP},
+		{"annotation argument", "@export_range(1, 10)\nvar x" + tail, "10", "20", true, CONFLICT_SKIP},
+		{"annotation split", "@export_range(1,\n\t10)\nvar x" + tail, "1,", "1, 5,", true, CONFLICT_SKIP},
+		{"annotation name", "@export\nvar x" + tail, "@export", "@onready", true, CONFLICT_SKIP},
+		{"conflict side", "<<<<<<< ours\nvar a = 1\n=======\nvar a = 2\n>>>>>>> theirs" + tail, "= 2", "= 3", false, CONFLICT_SKIP},
+		{"conflict ours", "<<<<<<< ours\nvar a = 1\n=======\nvar a = 2\n>>>>>>> theirs" + tail, "= 1", "= 3", false, CONFLICT_OURS},
+		{"conflict theirs", "<<<<<<< ours\nvar a = 1\n=======\nvar a = 2\n>>>>>>> theirs" + tail, "= 2", "= 3", false, CONFLICT_THEIRS},
+		{"conflict marker removed", "<<<<<<< ours\nvar a = 1\n=======\nvar a = 2\n>>>>>>> theirs" + tail, ">>>>>>> theirs", "", false, CONFLICT_OURS},
+		{"conflict marker added", "var a = 1\nvar b = 2" + tail, "var a", "<<<<<<< ours\nvar a", false, CONFLICT_THEIRS},
+		{"crlf", "var a = 1\r\nvar b = 2\r\n" + tail, "b", "bb", true, CONFLICT_SKIP},
+		{"paren", "var a = (1 +\n2)" + tail, "(", "", false, CONFLICT_SKIP},
+	}
+	for _, test := range tests {
+		for _, keepTrivia := range []bool{false, true} {
+			start := strings.Index(test.src, test.old)
+			if start < 0 {
+				t.Fatalf("%s: %q not found", test.name, test.old)
+			}
+			edit := TextEdit{Start: start, End: start + len(test.old), Text: test.text}
+			src := test.src[:edit.Start] + edit.Text + test.src[edit.End:]
+
+			tokenize := func(src string) []Token {
+				tokenizer := NewTokenizer(src)
+				tokenizer.SetKeepTrivia(keepTrivia)
+				tokenizer.SetConflictResolution(test.conflicts)
+				var tokens []Token
+				for token := range tokenizer.Tokens() {
+					tokens = append(tokens, token)
+				}
+				return tokens
+			}
+			old, want := tokenize(test.src), tokenize(src)
+
+			tokenizer := NewTokenizer(src)
+			tokenizer.SetKeepTrivia(keepTrivia)
+			tokenizer.SetConflictResolution(test.conflicts)
+			got := tokenizer.Retokenize(old, edit)
+
+			if !reflect.DeepEqual(got.Tokens, want) {
+				t.Errorf("%s (keepTrivia=%v): tokens differ from a full scan:\n got %v\nwant %v", test.name, keepTrivia, got.Tokens, want)
+				continue
+			}
+			if got.Old.Start != got.New.Start || got.Old.Start > got.Old.End || got.New.Start > got.New.End ||
+				len(old)-got.Old.End != len(got.Tokens)-got.New.End {
+				t.Errorf("%s (keepTrivia=%v): inconsistent ranges Old=%+v New=%+v for %d -> %d tokens", test.name, keepTrivia, got.Old, got.New, len(old), len(got.Tokens))
+				continue
+			}
+			if !reflect.DeepEqual(got.Tokens[:got.New.Start], old[:got.Old.Start]) {
+				t.Errorf("%s (keepTrivia=%v): tokens before New=%+v were not kept", test.name, keepTrivia, got.New)
+			}
+			// The tokens touching the edit must have been rescanned.
+			for i, token := range got.Tokens {
+				if token.Span.End.Offset >= edit.Start && token.Span.Start.Offset <= edit.Start+len(edit.Text) &&
+					(i < got.New.Start || i >= got.New.End) && token.Type != EOF {
+					t.Errorf("%s (keepTrivia=%v): token %d %v at the edit is outside New=%+v", test.name, keepTrivia, i, token.GetDebugName(), got.New)
+				}
+			}
+			if reused := len(old) - got.Old.End; test.reuse && reused <= 1 {
+				t.Errorf("%s (keepTrivia=%v): reused %d tokens after the edit", test.name, keepTrivia, reused)
+			}
+		}
+	}
+}
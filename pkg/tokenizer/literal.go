@@ -0,0 +1,222 @@
+package tokenizer
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+type LiteralKind int
+
+const (
+	LITERAL_NONE LiteralKind = iota // Not a literal token.
+	LITERAL_NULL
+	LITERAL_BOOL
+	LITERAL_INT
+	LITERAL_FLOAT
+	LITERAL_STRING
+	LITERAL_STRING_NAME
+	LITERAL_NODE_PATH
+)
+
+// StringNameLiteral is the value of a &"name" literal.
+type StringNameLiteral string
+
+// NodePathLiteral is the value of a ^"path" literal, split the same way the
+// engine splits a NodePath: "/root/Node:property:sub" has the names "root"
+// and "Node" and the subnames "property" and "sub".
+type NodePathLiteral struct {
+	Path     string // As written, after escapes.
+	Absolute bool
+	Names    []string
+	SubNames []string
+}
+
+func (p NodePathLiteral) String() string {
+	return p.Path
+}
+
+// invalidNodeNameChars can't appear inside a node name or subname.
+const invalidNodeNameChars = `.:@/"%`
+
+// ParseNodePath splits and validates a node path. Names may be "." or "..",
+// and may start with "%" to refer to a scene-unique node.
+func ParseNodePath(path string) (NodePathLiteral, error) {
+	result := NodePathLiteral{Path: path}
+	if path == "" {
+		return result, nil
+	}
+	names, subNames, hasSubNames := strings.Cut(path, ":")
+	if strings.HasPrefix(names, "/") {
+		result.Absolute = true
+		names = names[1:]
+		if names == "" {
+			return result, errors.New("Absolute node path has no node names.")
+		}
+	}
+	if names != "" {
+		result.Names = make([]string, 0, strings.Count(names, "/")+1)
+		for name := range strings.SplitSeq(names, "/") {
+			if name == "." || name == ".." {
+				result.Names = append(result.Names, name)
+				continue
+			}
+			if err := validateNodeName(strings.TrimPrefix(name, "%"), "node name"); err != nil {
+				return result, err
+			}
+			result.Names = append(result.Names, name)
+		}
+	}
+	if hasSubNames {
+		result.SubNames = make([]string, 0, strings.Count(subNames, ":")+1)
+		for subName := range strings.SplitSeq(subNames, ":") {
+			if err := validateNodeName(subName, "subname"); err != nil {
+				return result, err
+			}
+			result.SubNames = append(result.SubNames, subName)
+		}
+	}
+	return result, nil
+}
+
+func validateNodeName(name string, what string) error {
+	if name == "" {
+		return fmt.Errorf("Empty %s in node path.", what)
+	}
+	if i := strings.IndexAny(name, invalidNodeNameChars); i >= 0 {
+		return fmt.Errorf("Invalid character %q in %s %q.", name[i], what, name)
+	}
+	return nil
+}
+
+// IntValue returns the exact value of an integer literal.
+func (t Token) IntValue() (*big.Int, bool) {
+	switch value := t.Literal.(type) {
+	case int64:
+		return big.NewInt(value), true
+	case *big.Int:
+		return new(big.Int).Set(value), true
+	default:
+		return nil, false
+	}
+}
+
+// IntFits reports whether value is representable as an integer of the given
+// width in bits, such as 8 for i8 or 128 for i128.
+func IntFits(value *big.Int, bits int, signed bool) bool {
+	if !signed {
+		return value.Sign() >= 0 && value.BitLen() <= bits
+	}
+	if value.Sign() >= 0 {
+		return value.BitLen() < bits
+	}
+	// The smallest value is -2^(bits-1), whose magnitude needs bits bits.
+	magnitude := new(big.Int).Neg(value)
+	return magnitude.BitLen() < bits || (magnitude.BitLen() == bits && magnitude.TrailingZeroBits() == uint(bits-1))
+}
+
+// LiteralKind returns the kind of value a LITERAL token holds.
+func (t Token) LiteralKind() LiteralKind {
+	if t.Type != LITERAL {
+		return LITERAL_NONE
+	}
+	switch t.Literal.(type) {
+	case nil:
+		return LITERAL_NULL
+	case bool:
+		return LITERAL_BOOL
+	case int64, *big.Int:
+		return LITERAL_INT
+	case float64:
+		return LITERAL_FLOAT
+	case string:
+		return LITERAL_STRING
+	case StringNameLiteral:
+		return LITERAL_STRING_NAME
+	case NodePathLiteral:
+		return LITERAL_NODE_PATH
+	default:
+		return LITERAL_NONE
+	}
+}
+
+// NumberKind is the type requested by a numeric literal suffix such as the
+// "u8" in 255u8. Literals without a suffix are NUMBER_UNTYPED.
+type NumberKind uint8
+
+const (
+	NUMBER_UNTYPED NumberKind = iota
+	NUMBER_I8
+	NUMBER_I16
+	NUMBER_I32
+	NUMBER_I64
+	NUMBER_I128
+	NUMBER_U8
+	NUMBER_U16
+	NUMBER_U32
+	NUMBER_U64
+	NUMBER_U128
+	NUMBER_F32
+	NUMBER_F64
+)
+
+var numberSuffixes = map[string]NumberKind{
+	"i8":   NUMBER_I8,
+	"i16":  NUMBER_I16,
+	"i32":  NUMBER_I32,
+	"i64":  NUMBER_I64,
+	"i128": NUMBER_I128,
+	"u8":   NUMBER_U8,
+	"u16":  NUMBER_U16,
+	"u32":  NUMBER_U32,
+	"u64":  NUMBER_U64,
+	"u128": NUMBER_U128,
+	"f32":  NUMBER_F32,
+	"f64":  NUMBER_F64,
+}
+
+func (k NumberKind) String() string {
+	for suffix, kind := range numberSuffixes {
+		if kind == k {
+			return suffix
+		}
+	}
+	return "untyped"
+}
+
+func (k NumberKind) IsFloat() bool {
+	return k == NUMBER_F32 || k == NUMBER_F64
+}
+
+func (k NumberKind) Signed() bool {
+	return k < NUMBER_U8 || k.IsFloat()
+}
+
+// Bits returns the width of the type, or 0 for NUMBER_UNTYPED.
+func (k NumberKind) Bits() int {
+	switch k {
+	case NUMBER_I8, NUMBER_U8:
+		return 8
+	case NUMBER_I16, NUMBER_U16:
+		return 16
+	case NUMBER_I32, NUMBER_U32, NUMBER_F32:
+		return 32
+	case NUMBER_I64, NUMBER_U64, NUMBER_F64:
+		return 64
+	case NUMBER_I128, NUMBER_U128:
+		return 128
+	default:
+		return 0
+	}
+}
+
+// IntRange returns the smallest and largest values of an integer kind.
+func (k NumberKind) IntRange() (*big.Int, *big.Int) {
+	bits := uint(k.Bits())
+	if !k.Signed() {
+		return new(big.Int), new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), bits), big.NewInt(1))
+	}
+	limit := new(big.Int).Lsh(big.NewInt(1), bits-1)
+	return new(big.Int).Neg(limit), limit.Sub(limit, big.NewInt(1))
+}
@@ -0,0 +1,72 @@
+package tokenizer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+const readerSample = `#!/usr/bin/env ruzta
+/// A class.
+class Foo extends Bar {
+	@export var x := 1_000 + 0x_ff  # comment
+	var s = """
+		multi "line"
+	"""
+	fn f(a, b) Int { return f"{a} and {b:x}" + r"\raw" }
+	/* block /* nested */
+	   comment */
+	var p = ^"a/b:c"; var n = &"name"; var node = $Child/%Unique
+}
+`
+
+func TestReaderMatchesString(t *testing.T) {
+	src := strings.Repeat(readerSample, 200)
+	want, wantDiagnostics := Tokenize(src)
+	for _, keepTrivia := range []bool{false, true} {
+		tokenizer := NewReaderTokenizer(iotest.OneByteReader(strings.NewReader(src)))
+		tokenizer.SetKeepTrivia(keepTrivia)
+		var got []Token
+		for token := range tokenizer.Tokens() {
+			if !keepTrivia {
+				token.LeadingTrivia, token.TrailingTrivia = nil, nil
+			}
+			got = append(got, token)
+		}
+		for i := range want {
+			w := want[i]
+			if keepTrivia {
+				w.LeadingTrivia = got[i].LeadingTrivia
+				w.TrailingTrivia = got[i].TrailingTrivia
+			}
+			if i >= len(got) || !reflect.DeepEqual(got[i], w) {
+				t.Fatalf("keepTrivia=%v: token %d differs:\n got %+v\nwant %+v", keepTrivia, i, got[min(i, len(got)-1)], w)
+			}
+		}
+		if len(got) != len(want) {
+			t.Fatalf("keepTrivia=%v: got %d tokens, want %d", keepTrivia, len(got), len(want))
+		}
+		if !reflect.DeepEqual(tokenizer.Diagnostics(), wantDiagnostics) {
+			t.Fatalf("keepTrivia=%v: diagnostics differ:\n got %v\nwant %v", keepTrivia, tokenizer.Diagnostics(), wantDiagnostics)
+		}
+	}
+}
+
+func TestReaderBufferStaysBounded(t *testing.T) {
+	tests := map[string]string{
+		"blank lines":   strings.Repeat("\n", 1<<20),
+		"line comments": strings.Repeat("// some comment text\n", 1<<16),
+		"code":          strings.Repeat("var x = a + b // c\n", 1<<16),
+	}
+	for name, src := range tests {
+		tokenizer := NewReaderTokenizer(strings.NewReader(src))
+		longest := 0
+		for range tokenizer.Tokens() {
+			longest = max(longest, len(tokenizer.source))
+		}
+		if longest > 4*readerChunkSize {
+			t.Errorf("%s: buffer grew to %d bytes", name, longest)
+		}
+	}
+}
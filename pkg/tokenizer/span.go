@@ -0,0 +1,27 @@
+package tokenizer
+
+// Position is a point in the source. Offset is the 0-based byte offset from
+// the start of the file, Line and the columns are 1-based.
+type Position struct {
+	Offset      int
+	Line        int
+	Column      int // Counted in runes.
+	UTF16Column int // Counted in UTF-16 code units, as used by LSP.
+}
+
+// Span is the half-open range [Start, End) of source covered by a token.
+type Span struct {
+	File  string
+	Start Position
+	End   Position
+}
+
+// Len returns the length of the span in bytes.
+func (s Span) Len() int {
+	return s.End.Offset - s.Start.Offset
+}
+
+// Contains reports whether the byte offset lies within the span.
+func (s Span) Contains(offset int) bool {
+	return offset >= s.Start.Offset && offset < s.End.Offset
+}
@@ -0,0 +1,102 @@
+package tokenizer
+
+import "iter"
+
+// Tokens returns an iterator over the remaining tokens, ending with EOF.
+func (t *Tokenizer) Tokens() iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		for {
+			token := t.Scan()
+			if !yield(token) || token.Type == EOF {
+				return
+			}
+		}
+	}
+}
+
+// Tokenize scans all of src with the default options.
+func Tokenize(src string) ([]Token, []Diagnostic) {
+	t := NewTokenizer(src)
+	var tokens []Token
+	for token := range t.Tokens() {
+		tokens = append(tokens, token)
+	}
+	return tokens, t.Diagnostics()
+}
+
+// TokenStream buffers the tokens of a tokenizer so a parser can look ahead
+// and backtrack. Once the end is reached it keeps returning the EOF token.
+// Consumed tokens are dropped unless a mark still needs them, so memory
+// stays bounded however long the source is.
+type TokenStream struct {
+	tokenizer *Tokenizer
+	buffer    []Token
+	current   int // Index of the next token in buffer.
+	dropped   int // Number of tokens dropped from the front of buffer.
+	marks     int // Marks not released yet.
+}
+
+func NewTokenStream(t *Tokenizer) *TokenStream {
+	return &TokenStream{tokenizer: t}
+}
+
+// fill scans until the buffer holds the token n positions ahead.
+func (s *TokenStream) fill(n int) {
+	for len(s.buffer) <= s.current+n {
+		if last := len(s.buffer) - 1; last >= 0 && s.buffer[last].Type == EOF {
+			s.buffer = append(s.buffer, s.buffer[last])
+			continue
+		}
+		s.buffer = append(s.buffer, s.tokenizer.Scan())
+	}
+}
+
+// Peek returns the token n positions ahead without consuming anything.
+// Peek(0) is the token Next returns.
+func (s *TokenStream) Peek(n int) Token {
+	s.fill(n)
+	return s.buffer[s.current+n]
+}
+
+// Next consumes and returns the next token.
+func (s *TokenStream) Next() Token {
+	token := s.Peek(0)
+	if token.Type != EOF {
+		s.current++
+		s.trim()
+	}
+	return token
+}
+
+// trim drops the consumed tokens once they make up half of the buffer, so
+// each token is moved at most once on average.
+func (s *TokenStream) trim() {
+	if s.marks > 0 || s.current < 32 || s.current < len(s.buffer)/2 {
+		return
+	}
+	n := copy(s.buffer, s.buffer[s.current:])
+	clear(s.buffer[n:])
+	s.buffer = s.buffer[:n]
+	s.dropped += s.current
+	s.current = 0
+}
+
+// Mark returns the current position for a later Reset. Tokens from the
+// position on are kept until the mark is passed to Release.
+func (s *TokenStream) Mark() int {
+	s.marks++
+	return s.dropped + s.current
+}
+
+// Reset moves back to a position returned by Mark that was not released.
+func (s *TokenStream) Reset(mark int) {
+	s.current = mark - s.dropped
+}
+
+// Release tells the stream that mark won't be passed to Reset anymore.
+func (s *TokenStream) Release(mark int) {
+	if s.marks > 0 {
+		s.marks--
+	}
+	s.trim()
+}
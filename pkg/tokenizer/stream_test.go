@@ -0,0 +1,61 @@
+package tokenizer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTokenStreamBacktrack(t *testing.T) {
+	src := strings.Repeat("a + b\n", 100)
+	want, _ := Tokenize(src)
+	s := NewTokenStream(NewTokenizer(src))
+
+	if got := s.Peek(2); got.Source != want[2].Source {
+		t.Fatalf("Peek(2) = %q, want %q", got.Source, want[2].Source)
+	}
+	mark := s.Mark()
+	for range 300 {
+		s.Next()
+	}
+	s.Reset(mark)
+	for i, w := range want {
+		got := s.Next()
+		if got.Type != w.Type || got.Span != w.Span {
+			t.Fatalf("token %d after Reset = %s at %v, want %s at %v", i, got.GetDebugName(), got.Span, w.GetDebugName(), w.Span)
+		}
+	}
+	s.Release(mark)
+	for range 3 {
+		if got := s.Next(); got.Type != EOF {
+			t.Fatalf("Next past the end = %s, want EOF", got.GetDebugName())
+		}
+	}
+}
+
+func TestTokenStreamDropsConsumedTokens(t *testing.T) {
+	s := NewTokenStream(NewTokenizer(strings.Repeat("a + b\n", 10000)))
+	for s.Next().Type != EOF {
+		if len(s.buffer) > 64 {
+			t.Fatalf("buffer holds %d tokens without a mark", len(s.buffer))
+		}
+	}
+
+	s = NewTokenStream(NewTokenizer(strings.Repeat("a + b\n", 100)))
+	s.Next()
+	mark := s.Mark()
+	first := s.Peek(0)
+	for range 200 {
+		s.Next()
+	}
+	s.Reset(mark)
+	if got := s.Next(); got.Span != first.Span {
+		t.Fatalf("token at mark = %v, want %v", got.Span, first.Span)
+	}
+	s.Release(mark)
+	for range 200 {
+		s.Next()
+	}
+	if len(s.buffer) > 300 {
+		t.Fatalf("buffer holds %d tokens after Release", len(s.buffer))
+	}
+}
@@ -1,6 +1,6 @@
 package tokenizer
 
-type CursorPlace int
+type CursorPlace uint8
 
 const (
 	CURSOR_NONE CursorPlace = iota
@@ -9,7 +9,7 @@ const (
 	CURSOR_END
 )
 
-type TokenType int
+type TokenType uint8
 
 const (
 	EMPTY TokenType = iota
@@ -17,6 +17,10 @@ const (
 	ANNOTATION
 	IDENTIFIER
 	LITERAL
+	INTERPOLATION_START
+	INTERPOLATION_MIDDLE
+	INTERPOLATION_END
+	NODE_REFERENCE // $Path/To/Node, $"Path" or $%Unique, holding a NodePathLiteral.
 	// Comparison
 	LESS
 	LESS_EQUAL
@@ -123,14 +127,19 @@ const (
 
 type Token struct {
 	Type           TokenType
+	CursorPlace    CursorPlace
+	NumberKind     NumberKind  // Requested by a numeric literal suffix.
 	Literal        interface{} // Variant in C++, can be string/int/etc.
 	StartLine      int
 	EndLine        int
 	StartColumn    int
 	EndColumn      int
 	CursorPosition int
-	CursorPlace    CursorPlace
-	Source         []rune
+	Source         string
+	Span           Span
+	LeadingTrivia  []Trivia
+	TrailingTrivia []Trivia
+	Doc            string // Doc comment of the declaration this keyword starts.
 }
 
 func NewToken(p_type TokenType) *Token {
@@ -141,7 +150,7 @@ func NewToken(p_type TokenType) *Token {
 	}
 }
 
-func (t *Token) GetName() string {
+func (t Token) GetName() string {
 	switch t.Type {
 	case EMPTY:
 		return "Empty"
@@ -153,6 +162,14 @@ func (t *Token) GetName() string {
 		return "Identifier"
 	case LITERAL:
 		return "Literal"
+	case INTERPOLATION_START:
+		return "Interpolation start"
+	case INTERPOLATION_MIDDLE:
+		return "Interpolation middle"
+	case INTERPOLATION_END:
+		return "Interpolation end"
+	case NODE_REFERENCE:
+		return "Node reference"
 
 	// Comparison
 	case LESS:
@@ -361,14 +378,17 @@ func (t *Token) GetName() string {
 	}
 }
 
-
-func (t *Token) GetDebugName() string {
+func (t Token) GetDebugName() string {
 	if t.Type == IDENTIFIER {
-		return "identifier: " + string(t.Source)
+		return "identifier: " + t.Source
 	}
 
 	if t.Type == LITERAL {
-		return "Literal: " + string(t.Source)
+		return "Literal: " + t.Source
+	}
+
+	if t.Type == INTERPOLATION_START || t.Type == INTERPOLATION_MIDDLE || t.Type == INTERPOLATION_END || t.Type == NODE_REFERENCE {
+		return t.GetName() + ": " + t.Source
 	}
 
 	if t.Type == ERROR {
@@ -382,9 +402,9 @@ func (t *Token) GetDebugName() string {
 	return t.GetName()
 }
 
-func (t *Token) CanPrecedeBinOP() bool {
+func (t Token) CanPrecedeBinOP() bool {
 	switch t.Type {
-	case IDENTIFIER, LITERAL, SELF, BRACKET_CLOSE,
+	case IDENTIFIER, LITERAL, INTERPOLATION_END, NODE_REFERENCE, SELF, BRACKET_CLOSE,
 		BRACE_CLOSE, PARENTHESIS_CLOSE,
 		CONST_PI, CONST_TAU, CONST_INF, CONST_NAN:
 		return true
@@ -393,7 +413,23 @@ func (t *Token) CanPrecedeBinOP() bool {
 	}
 }
 
-func (t *Token) IsIdentifier() bool {
+// CanEndStatement reports whether a line break right after the token ends
+// the statement, as with automatic semicolons in Go. After any other token
+// the statement continues on the next line.
+func (t Token) CanEndStatement() bool {
+	if t.CanPrecedeBinOP() {
+		return true
+	}
+	switch t.Type {
+	case ANNOTATION, BREAK, CONTINUE, PASS, RETURN, VOID, UNDERSCORE,
+		QUESTION_MARK, VCS_CONFLICT_MARKER, ERROR:
+		return true
+	default:
+		return false
+	}
+}
+
+func (t Token) IsIdentifier() bool {
 	switch t.Type {
 	case IDENTIFIER, MATCH, WHEN, CONST_PI,
 		CONST_TAU, CONST_INF, CONST_NAN:
@@ -403,7 +439,7 @@ func (t *Token) IsIdentifier() bool {
 	}
 }
 
-func (t *Token) IsNodeName() bool {
+func (t Token) IsNodeName() bool {
 	switch t.Type {
 	case IDENTIFIER, AND, AS, BREAK,
 		CLASS, CONST, CONST_PI, CONST_INF,
@@ -2,49 +2,161 @@ package tokenizer
 
 import (
 	"fmt"
+	"hash/maphash"
+	"io"
+	"math"
+	"math/big"
+	"math/bits"
+	"slices"
 	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
 )
 
 type Tokenizer struct {
-	source           []rune
-	_start           int
-	startLine        int
-	startColumn      int
-	errorStack       []*Token
-	pendingNewline   bool
-	lastToken        *Token
-	lastNewline      *Token
-	_current         int
-	line             int
-	column           int
-	position         int
-	length           int
-	tabSize          int
-	parenStack       []rune
+	source          string
+	_start          int
+	startColumn     int
+	startPos        Position
+	diagnostics     []Diagnostic
+	pendingNewline  bool
+	lastType        TokenType // Type of the last token made, EMPTY at the start.
+	lastLine        int       // Line the last token made ends on.
+	token           Token     // Filled in by makeToken and copied out by Scan.
+	_current        int
+	line            int
+	tabSize         int
+	parenStack      []rune
+	reader          io.Reader
+	readBuffer      []byte
+	readErr         error
+	streaming       bool
+	file            string
+	base            int // Offset of source[0] in the whole input.
+	stripIndent     bool
+	interpolations  []stringFrame
+	commaSeparators bool
+	keepTrivia      bool
+	trivia          []Trivia
+	docLines        []string
+	annotationArgs  int
+	cursorLine      int
+	cursorColumn    int
+	columnEncoding  ColumnEncoding
+	conflicts       ConflictResolution
+	inConflict      bool                 // Scanning the chosen side of a conflict region.
+	lineOffset      int                  // Offset where the current line starts.
+	shifts          [COLUMN_BYTE + 1]int // Column minus byte column, by encoding.
+	names           []int32              // Hash table of nameList entries, see findName.
+	nameSeed        maphash.Seed
+	nameList        [][]nameEntry
+	nameCount       int
+	recentNames     [64]interface{}
+	sightings       map[string]sighting // Non-ASCII names by skeleton, see checkIdentifier.
+	scratch         []byte
 }
 
+// readerChunkSize is the smallest number of bytes read from the reader per
+// fill. The buffer only holds the current token, or the current piece of
+// trivia, plus whatever lookahead is needed, so memory stays bounded by the
+// longest token rather than the size of the input.
+const readerChunkSize = 4096
+
+// lookahead is how many bytes past the current one peek can see. It must
+// cover the longest UTF-8 sequence.
+const lookahead = 8
+
+// byteOrderMark is skipped at the start of the source.
+const byteOrderMark = 0xFEFF
+
 func NewTokenizer(src string) *Tokenizer {
 	return &Tokenizer{
-		source:      []rune(src),
-		line:        1,
-		column:      1,
-		length:      len([]rune(src)),
-		tabSize:     4,
+		source:  src,
+		line:    1,
+		tabSize: 4,
 	}
 }
 
-func isDigit(p_char rune) bool {
-	return p_char >= '0' && p_char <= '9'
+// NewReaderTokenizer creates a tokenizer that reads UTF-8 from r
+// incrementally instead of loading the whole source up front.
+func NewReaderTokenizer(r io.Reader) *Tokenizer {
+	return &Tokenizer{
+		reader:    r,
+		streaming: true,
+		line:      1,
+		tabSize:   4,
+	}
 }
 
-func isUnicodeIdentifierStart(r rune) bool {
-	return r == '_' || unicode.IsLetter(r)
+// SetFileName sets the file name recorded in the span of every token.
+func (t *Tokenizer) SetFileName(name string) {
+	t.file = name
+	// Nothing else sets the file of the token under construction.
+	t.token.Span.File = name
 }
 
-func isUnicodeIdentifierContinue(r rune) bool {
-	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+// SetStripIndent makes multi-line strings drop the indentation shared by
+// their lines, a blank line after the opening quotes and the line break
+// before closing quotes that sit on their own line.
+func (t *Tokenizer) SetStripIndent(enabled bool) {
+	t.stripIndent = enabled
+}
+
+// SetCommaSeparators lets "," separate thousand groups in decimal numbers,
+// as in 1,000,000. It is off by default because "f(1,234)" then reads as a
+// single argument.
+func (t *Tokenizer) SetCommaSeparators(enabled bool) {
+	t.commaSeparators = enabled
+}
+
+// SetTabSize sets how many visual columns a tab advances. The default is 4.
+// Sizes below 1 are raised to 1, so a tab always takes up a column.
+func (t *Tokenizer) SetTabSize(size int) {
+	t.tabSize = max(size, 1)
+}
+
+// SetColumnEncoding selects how the StartColumn and EndColumn of tokens are
+// counted. The default is COLUMN_VISUAL.
+func (t *Tokenizer) SetColumnEncoding(encoding ColumnEncoding) {
+	if encoding < 0 || encoding > COLUMN_BYTE {
+		encoding = COLUMN_VISUAL
+	}
+	t.columnEncoding = encoding
+}
+
+// SetCursor sets the position of the editing cursor, counted like the
+// StartLine and StartColumn of tokens. Every token containing it or ending
+// or starting right at it gets its CursorPosition and CursorPlace set.
+func (t *Tokenizer) SetCursor(line, column int) {
+	t.cursorLine = line
+	t.cursorColumn = column
+}
+
+// Diagnostics returns every problem found so far, in source order.
+func (t *Tokenizer) Diagnostics() []Diagnostic {
+	return t.diagnostics
+}
+
+// HasErrors reports whether any error-severity diagnostic was recorded.
+func (t *Tokenizer) HasErrors() bool {
+	for i := range t.diagnostics {
+		if t.diagnostics[i].Severity == SEVERITY_ERROR {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns the first non-EOF error encountered while reading the source.
+func (t *Tokenizer) Err() error {
+	return t.readErr
+}
+
+func isDigit(p_char rune) bool {
+	return p_char >= '0' && p_char <= '9'
 }
 
 func isWhitespace(ch rune) bool {
@@ -61,29 +173,186 @@ func isWhitespace(ch rune) bool {
 		ch == 0x0085
 }
 
+// fill reads more of the reader into the buffer and reports whether
+// anything was added. The buffered source is copied into readBuffer, grown
+// by at least its own length and turned back into a string, so a long token
+// is copied a constant number of times on average.
+func (t *Tokenizer) fill() bool {
+	if t.reader == nil {
+		return false
+	}
+	buffer := append(t.readBuffer[:0], t.source...)
+	want := len(buffer) + max(readerChunkSize, len(buffer))
+	buffer = slices.Grow(buffer, want-len(buffer))
+	for len(buffer) < want && t.reader != nil {
+		n, err := t.reader.Read(buffer[len(buffer):want])
+		buffer = buffer[:len(buffer)+n]
+		if err != nil {
+			if err != io.EOF {
+				t.readErr = err
+			}
+			t.reader = nil
+		}
+	}
+	t.readBuffer = buffer
+	if len(buffer) == len(t.source) {
+		return false
+	}
+	t.source = string(buffer)
+	return true
+}
+
+// ensure makes sure the byte at idx is buffered, reading more input if
+// needed. It returns false if idx is past the end of the source.
+func (t *Tokenizer) ensure(idx int) bool {
+	for idx >= len(t.source) {
+		if !t.fill() {
+			return false
+		}
+	}
+	return true
+}
+
+// compact drops the source before the current token from the buffer. Tokens
+// keep their own reference to the text they cover, so this is safe.
+func (t *Tokenizer) compact() {
+	if !t.streaming || t._start < readerChunkSize {
+		return
+	}
+	t.dropStart()
+}
+
+// compactTrivia drops the trivia scanned so far from the buffer when it
+// isn't kept, so long runs of comments and blank lines don't pile up.
+func (t *Tokenizer) compactTrivia() {
+	if !t.streaming || t.keepTrivia || t._current < readerChunkSize {
+		return
+	}
+	t._start = t._current
+	t.dropStart()
+}
+
+// dropStart drops the source before _start from the buffer.
+func (t *Tokenizer) dropStart() {
+	t.source = t.source[t._start:]
+	t._current -= t._start
+	t.base += t._start
+	t._start = 0
+}
+
+// refill keeps at least lookahead bytes past the current one buffered while
+// the reader has more to give, so peek and isAtEnd never need to read.
+func (t *Tokenizer) refill() {
+	for t._current+lookahead >= len(t.source) && t.fill() {
+	}
+}
+
 func (t *Tokenizer) isAtEnd() bool {
-	return t._current >= t.length
+	return t._current >= len(t.source)
 }
 
+// peek returns the byte offset bytes ahead, for offsets below lookahead.
+// Characters outside of ASCII show up as their leading byte, so use peekRune
+// wherever they matter.
 func (t *Tokenizer) peek(offset int) rune {
-	idx := t._current + offset
-	if idx >= 0 && idx < t.length {
-		return t.source[idx]
+	if idx := t._current + offset; uint(idx) < uint(len(t.source)) {
+		return rune(t.source[idx])
 	}
 	return 0
 }
 
+// peekAhead is peek for any offset, reading more input if needed.
+func (t *Tokenizer) peekAhead(offset int) rune {
+	if idx := t._current + offset; idx >= 0 && t.ensure(idx) {
+		return rune(t.source[idx])
+	}
+	return 0
+}
+
+// peekRune decodes the character at the current position.
+func (t *Tokenizer) peekRune() rune {
+	if t.isAtEnd() {
+		return 0
+	}
+	if c := t.source[t._current]; c < utf8.RuneSelf {
+		return rune(c)
+	}
+	c, _ := utf8.DecodeRuneInString(t.source[t._current:])
+	return c
+}
+
 func (t *Tokenizer) advance() rune {
+	if t._current+lookahead < len(t.source) {
+		if c := t.source[t._current]; c < utf8.RuneSelf && c != '\t' {
+			t._current++
+			return rune(c)
+		}
+	}
+	return t.advanceRune()
+}
+
+// advanceRune is advance for tabs, characters outside of ASCII and the end
+// of the buffer.
+func (t *Tokenizer) advanceRune() rune {
 	if t.isAtEnd() {
 		return 0
 	}
-	ch := t.source[t._current]
-	t._current++
-	t.position++
-	t.column++
+	ch, size := rune(t.source[t._current]), 1
+	if ch >= utf8.RuneSelf {
+		ch, size = utf8.DecodeRuneInString(t.source[t._current:])
+	}
+	t._current += size
+	t.shifts[COLUMN_RUNE] += 1 - size
+	t.shifts[COLUMN_VISUAL] += columnWidth(ch, COLUMN_VISUAL, t.tabSize) - size
+	t.shifts[COLUMN_UTF16] += columnWidth(ch, COLUMN_UTF16, t.tabSize) - size
+	t.refill()
 	return ch
 }
 
+// offset returns the current offset in the whole input.
+func (t *Tokenizer) offset() int {
+	return t.base + t._current
+}
+
+// byteColumn returns the current column counted in bytes.
+func (t *Tokenizer) byteColumn() int {
+	return t.base + t._current - t.lineOffset + 1
+}
+
+// pos returns the current position in the source.
+func (t *Tokenizer) pos() Position {
+	column := t.byteColumn()
+	return Position{
+		Offset:      t.offset(),
+		Line:        t.line,
+		Column:      column + t.shifts[COLUMN_RUNE],
+		UTF16Column: column + t.shifts[COLUMN_UTF16],
+	}
+}
+
+// currentColumn returns the current column in the selected encoding.
+func (t *Tokenizer) currentColumn() int {
+	return t.byteColumn() + t.shifts[t.columnEncoding]
+}
+
+// markStart records the current position as the start of the next token.
+func (t *Tokenizer) markStart() {
+	t._start = t._current
+	t.startColumn = t.currentColumn()
+	t.startPos = t.pos()
+}
+
+// markPrevious records the last consumed character as the start of the next
+// token. It is only used for single-byte characters such as line breaks.
+func (t *Tokenizer) markPrevious() {
+	t.markStart()
+	t._start--
+	t.startColumn--
+	t.startPos.Offset--
+	t.startPos.Column--
+	t.startPos.UTF16Column--
+}
+
 func (t *Tokenizer) pushParen(char rune) {
 	t.parenStack = append(t.parenStack, char)
 }
@@ -92,46 +361,147 @@ func (t *Tokenizer) popParen(expected rune) bool {
 	if len(t.parenStack) == 0 {
 		return false
 	}
-	actual := t.parenStack[len(t.parenStack)-1]
+	// Leave a mismatched opening on the stack for makeParenError to report.
+	if t.parenStack[len(t.parenStack)-1] != expected {
+		return false
+	}
 	t.parenStack = t.parenStack[:len(t.parenStack)-1]
-	return actual == expected
+	return true
 }
 
 func (t *Tokenizer) makeParenError(paren rune) *Token {
 	if len(t.parenStack) == 0 {
-		return t.makeError(fmt.Sprintf("Closing \"%c\" doesn't have an opening counterpart.", paren))
+		rError := t.makeError(ERR_UNMATCHED_PAREN, fmt.Sprintf("Closing \"%c\" doesn't have an opening counterpart.", paren))
+		t.lastDiagnostic().Fix = &SuggestedFix{Message: "Remove it.", Span: rError.Span}
+		return rError
+	}
+	opening := t.parenStack[len(t.parenStack)-1]
+	rError := t.makeError(ERR_UNMATCHED_PAREN, fmt.Sprintf("Closing \"%c\" doesn't match the opening \"%c\".", paren, opening))
+	closing := closingParen(opening)
+	t.lastDiagnostic().Fix = &SuggestedFix{
+		Message:     fmt.Sprintf("Replace it with \"%c\".", closing),
+		Span:        rError.Span,
+		Replacement: string(closing),
+	}
+	// Keep the brace of an embedded expression so its string can resume.
+	if !t.inInterpolation() {
+		t.parenStack = t.parenStack[:len(t.parenStack)-1]
 	}
-	rError := t.makeError(fmt.Sprintf("Closing \"%c\" doesn't match the opening \"%c\".", paren, t.parenStack[len(t.parenStack)-1]))
-	t.parenStack = t.parenStack[:len(t.parenStack)-1]
 	return rError
 }
 
-func (t *Tokenizer) hasError() bool {
-	return len(t.errorStack) > 0
+func closingParen(opening rune) rune {
+	switch opening {
+	case '(':
+		return ')'
+	case '[':
+		return ']'
+	default:
+		return '}'
+	}
 }
 
-func (t *Tokenizer) pushError(msg string) {
-	rError := t.makeError(msg)
-	t.errorStack = append(t.errorStack, rError)
+// report records a diagnostic for the given span.
+func (t *Tokenizer) report(span Span, severity Severity, code DiagnosticCode, msg string) {
+	t.diagnostics = append(t.diagnostics, Diagnostic{
+		Code:     code,
+		Severity: severity,
+		Span:     span,
+		Message:  msg,
+	})
 }
 
-func (t *Tokenizer) popError() *Token {
-	rError := t.errorStack[len(t.errorStack)-1]
-	t.errorStack = t.errorStack[:len(t.errorStack)-1]
-	return rError
+// reportError records an error spanning from the marked start to the
+// current position without producing a token.
+func (t *Tokenizer) reportError(code DiagnosticCode, msg string) {
+	t.reportFrom(t.startPos, code, msg)
+}
+
+// reportFrom records an error spanning from start to the current position.
+func (t *Tokenizer) reportFrom(start Position, code DiagnosticCode, msg string) {
+	t.report(Span{File: t.file, Start: start, End: t.pos()}, SEVERITY_ERROR, code, msg)
+}
+
+// lastDiagnostic returns the most recently recorded diagnostic so callers can
+// attach notes or fixes to it.
+func (t *Tokenizer) lastDiagnostic() *Diagnostic {
+	return &t.diagnostics[len(t.diagnostics)-1]
 }
 
+// makeToken fills in the token under construction and returns it. The same
+// Token is reused for every token, so it is only valid until the next call;
+// Scan returns a copy.
 func (t *Tokenizer) makeToken(tokenType TokenType) *Token {
-	token := NewToken(tokenType)
-	token.StartLine = t.line
+	token := &t.token
+	token.Type = tokenType
+	token.StartLine = t.startPos.Line
 	token.EndLine = t.line
-	token.StartColumn = t.column
-	token.EndColumn = t.column
+	token.StartColumn = t.startColumn
+	token.EndColumn = t.currentColumn()
+	token.CursorPosition = -1
+	token.CursorPlace = CURSOR_NONE
 	token.Source = t.source[t._start:t._current]
-	t.lastToken = token
+	token.Span.Start = t.startPos
+	token.Span.End = t.pos()
+	token.NumberKind = NUMBER_UNTYPED
+	// Storing a pointer in the tokenizer costs a write barrier while the
+	// garbage collector runs, so fields that are rarely set are only cleared
+	// when they were.
+	if token.Literal != nil {
+		token.Literal = nil
+	}
+	if token.LeadingTrivia != nil || token.TrailingTrivia != nil || token.Doc != "" {
+		token.LeadingTrivia = nil
+		token.TrailingTrivia = nil
+		token.Doc = ""
+	}
+	if t.keepTrivia {
+		token.LeadingTrivia = t.trivia
+		t.trivia = nil
+	}
+	if t.cursorLine != 0 {
+		t.flagCursor(token)
+	}
+	t.lastType = tokenType
+	t.lastLine = t.line
 	return token
 }
 
+// flagCursor marks token if the cursor lies inside it or touches either of
+// its ends. CursorPosition is the byte index in Source of the character after
+// the cursor.
+func (t *Tokenizer) flagCursor(token *Token) {
+	if t.cursorLine == 0 {
+		return
+	}
+	if t.cursorLine < token.StartLine || (t.cursorLine == token.StartLine && t.cursorColumn < token.StartColumn) ||
+		t.cursorLine > token.EndLine || (t.cursorLine == token.EndLine && t.cursorColumn > token.EndColumn) {
+		return
+	}
+	line, column, position := token.StartLine, token.StartColumn, len(token.Source)
+	for i, c := range token.Source {
+		if line > t.cursorLine || (line == t.cursorLine && column >= t.cursorColumn) {
+			position = i
+			break
+		}
+		if c == '\n' {
+			line++
+			column = 1
+		} else {
+			column += columnWidth(c, t.columnEncoding, t.tabSize)
+		}
+	}
+	token.CursorPosition = position
+	switch {
+	case position == 0:
+		token.CursorPlace = CURSOR_BEGINNING
+	case position < len(token.Source):
+		token.CursorPlace = CURSOR_MIDDLE
+	default:
+		token.CursorPlace = CURSOR_END
+	}
+}
+
 func (t *Tokenizer) makeLiteral(value interface{}) *Token {
 	token := t.makeToken(LITERAL)
 	token.Literal = value
@@ -140,47 +510,146 @@ func (t *Tokenizer) makeLiteral(value interface{}) *Token {
 
 func (t *Tokenizer) makeIdentifier(name string) *Token {
 	token := t.makeToken(IDENTIFIER)
-	token.Literal = name
+	value, first := t.intern(name, token.Span.Start)
+	token.Literal = value
+	if first {
+		t.checkIdentifier(token, value.(string))
+	}
 	return token
 }
 
-func (t *Tokenizer) makeError(msg string) *Token {
+// nameEntry is an interned name and where it was first seen.
+type nameEntry struct {
+	value interface{} // The NFC form, boxed for token literals.
+	start Position
+}
+
+// intern returns the NFC form of name boxed for a token literal and whether
+// it is seen for the first time, at start. Every occurrence of a name shares
+// one copy, so identifiers cost no allocation after the first.
+func (t *Tokenizer) intern(name string, start Position) (interface{}, bool) {
+	// Most names repeat soon, so check a small cache before the table.
+	slot := &t.recentNames[(len(name)*31+int(name[0])*7+int(name[len(name)-1]))%len(t.recentNames)]
+	if recent, ok := (*slot).(string); ok && recent == name {
+		return *slot, false
+	}
+	if !isASCII(name) {
+		name = norm.NFC.String(name)
+	}
+	if t.names == nil {
+		// Typical code introduces a new name every hundred bytes or so, and
+		// the table is kept at most half full.
+		t.names = make([]int32, max(64, 1<<bits.Len(uint(len(t.source)/128))))
+		t.nameSeed = maphash.MakeSeed()
+	}
+	i := t.findName(name)
+	if t.names[i] != 0 {
+		*slot = t.name(int(t.names[i]) - 1).value
+		return *slot, false
+	}
+	if t.streaming {
+		// Don't keep the whole read buffer alive for the name.
+		name = strings.Clone(name)
+	}
+	index := t.nameCount
+	if index%nameChunkSize == 0 {
+		t.nameList = append(t.nameList, make([]nameEntry, nameChunkSize))
+	}
+	*t.name(index) = nameEntry{value: name, start: start}
+	t.nameCount++
+	t.names[i] = int32(t.nameCount)
+	if t.nameCount*2 > len(t.names) {
+		t.names = make([]int32, len(t.names)*2)
+		for index := range t.nameCount {
+			t.names[t.findName(t.name(index).value.(string))] = int32(index + 1)
+		}
+	}
+	*slot = t.name(index).value
+	return *slot, true
+}
+
+// findName returns the slot of name in the names table, which is free if
+// name isn't interned. Slots hold one plus the index of the name, so zero is
+// free, and are probed in order from the hash of name.
+func (t *Tokenizer) findName(name string) int {
+	mask := len(t.names) - 1
+	i := int(maphash.String(t.nameSeed, name)) & mask
+	for t.names[i] != 0 && t.name(int(t.names[i])-1).value.(string) != name {
+		i = (i + 1) & mask
+	}
+	return i
+}
+
+// nameChunkSize is how many names are allocated at once. The chunks are
+// never moved, so a growing file doesn't copy the names seen so far.
+const nameChunkSize = 256
+
+// name returns the interned name at index.
+func (t *Tokenizer) name(index int) *nameEntry {
+	return &t.nameList[index/nameChunkSize][index%nameChunkSize]
+}
+
+// makeError returns an ERROR token covering the current lexeme and records
+// a matching diagnostic. Scanning can resume right after it.
+func (t *Tokenizer) makeError(code DiagnosticCode, msg string) *Token {
 	token := t.makeToken(ERROR)
 	token.Literal = msg
+	t.report(token.Span, SEVERITY_ERROR, code, msg)
 	return token
 }
 
-
 func (t *Tokenizer) skipWhitespace() {
 	for {
+		if c := t.peek(0); c < utf8.RuneSelf && !triviaStarts[c] {
+			return
+		}
+		t.compactTrivia()
+		var start Position
+		if t.keepTrivia {
+			start = t.pos()
+		}
+		idx := t._current
+		kind := TRIVIA_WHITESPACE
 		switch t.peek(0) {
-		case ' ':
-			t.advance()
-
-		case '\t':
-			t.advance()
-			t.column += t.tabSize - 1
+		case ' ', '\t':
+			t.skipSpaces()
 
 		case '\r':
 			t.advance()
 			if t.peek(0) != '\n' {
-				t.pushError("Stray carriage return character in source code.")
-				return
+				t.markPrevious()
+				t.reportError(ERR_STRAY_CARRIAGE_RETURN, "Stray carriage return character in source code.")
 			}
 
 		case '\n':
 			t.advance()
-			t.newline(true)
+			if t.newline(true) {
+				// The line break is the source of the NEWLINE token.
+				continue
+			}
+			kind = TRIVIA_NEWLINE
 
 		case '#':
+			kind = TRIVIA_LINE_COMMENT
+			if t.peek(1) == '!' && t.line == 1 && t.offset() == t.lineOffset {
+				kind = TRIVIA_SHEBANG
+			} else if t.isDocComment() {
+				kind = TRIVIA_DOC_COMMENT
+			}
 			t.skipLineComment()
 
 		case '/':
 			if t.peek(1) == '/' {
+				kind = TRIVIA_LINE_COMMENT
+				if t.isDocComment() {
+					kind = TRIVIA_DOC_COMMENT
+				}
 				t.advance()
 				t.advance()
 				t.skipLineComment()
 			} else if t.peek(1) == '*' {
+				kind = TRIVIA_BLOCK_COMMENT
+				t.markStart()
 				t.advance()
 				t.advance()
 				t.skipBlockComment()
@@ -188,75 +657,221 @@ func (t *Tokenizer) skipWhitespace() {
 				return
 			}
 
+		case '<', '|', '=', '>':
+			if !t.skipConflict() {
+				return
+			}
+			kind = TRIVIA_CONFLICT
+
 		default:
+			c := t.peek(0)
+			if c > ' ' && c < utf8.RuneSelf {
+				return
+			}
+			if c >= utf8.RuneSelf {
+				c = t.peekRune()
+			}
+			if c == byteOrderMark && t.offset() == 0 {
+				// The first line starts after the mark, so columns ignore it.
+				t.advance()
+				t.newColumns()
+				kind = TRIVIA_BYTE_ORDER_MARK
+				break
+			}
+			if !isWhitespace(c) {
+				return
+			}
+			t.advance()
+		}
+		if kind == TRIVIA_DOC_COMMENT && t.startsLine() {
+			t.docLines = append(t.docLines, docText(t.source[idx:t._current]))
+		}
+		if t.keepTrivia {
+			t.trivia = t.appendTrivia(t.trivia, kind, start, idx)
+		}
+	}
+}
+
+// triviaStarts marks the ASCII characters skipWhitespace may skip over, so
+// it can return at once on any other. Control characters are all marked and
+// left to its switch.
+var triviaStarts = func() (table [utf8.RuneSelf]bool) {
+	for c := range ' ' {
+		table[c] = true
+	}
+	for _, c := range " #/<|=>" {
+		table[c] = true
+	}
+	return table
+}()
+
+// skipSpaces skips a run of spaces and tabs.
+func (t *Tokenizer) skipSpaces() {
+	for {
+		src, i, tabs := t.source, t._current, 0
+		for ; i < len(src); i++ {
+			if c := src[i]; c == '\t' {
+				tabs++
+			} else if c != ' ' {
+				break
+			}
+		}
+		// A tab is one rune and one UTF-16 unit, but tabSize visual columns.
+		t.shifts[COLUMN_VISUAL] += tabs * (columnWidth('\t', COLUMN_VISUAL, t.tabSize) - 1)
+		t.skipASCII(i - t._current)
+		if c := t.peek(0); c != ' ' && c != '\t' {
 			return
 		}
 	}
 }
 
+// skipText skips printable ASCII, stopping at tabs, line breaks and
+// characters outside of ASCII.
+func (t *Tokenizer) skipText() {
+	i := t._current
+	for i < len(t.source) && t.source[i] >= ' ' && t.source[i] < utf8.RuneSelf {
+		i++
+	}
+	t.skipASCII(i - t._current)
+}
+
+// skipASCII moves past n buffered bytes that are each a single column wide.
+func (t *Tokenizer) skipASCII(n int) {
+	t._current += n
+	t.refill()
+}
+
+// skipLineComment skips to the end of the line, leaving the line break for
+// skipWhitespace.
 func (t *Tokenizer) skipLineComment() {
-	for t.peek(0) != '\n' && !t.isAtEnd() {
+	for {
+		t.skipText()
+		if t.isAtEnd() || t.peek(0) == '\n' || (t.peek(0) == '\r' && t.peek(1) == '\n') {
+			return
+		}
 		t.advance()
 	}
-	if t.isAtEnd() {
-		return
-	}
-	t.advance()
-	t.newline(true)
 }
 
+// skipBlockComment skips the rest of a block comment whose "/*" was just
+// consumed. Block comments nest, so code that already contains one can be
+// commented out.
 func (t *Tokenizer) skipBlockComment() {
+	commentStart := t.startPos
+	depth := 1
 	for {
 		if t.isAtEnd() {
-			t.pushError("Unterminated block comment.")
+			t.startPos = commentStart
+			t.reportError(ERR_UNTERMINATED_COMMENT, "Unterminated block comment.")
 			return
 		}
+		// Skip to the next character that could matter.
+		i := t._current
+		for i < len(t.source) && t.source[i] >= ' ' && t.source[i] < utf8.RuneSelf && t.source[i] != '*' && t.source[i] != '/' {
+			i++
+		}
+		t.skipASCII(i - t._current)
+		if t.isAtEnd() {
+			continue
+		}
 		if t.peek(0) == '\r' {
 			t.advance()
 			if t.peek(0) != '\n' {
-				t.pushError("Stray carriage return character in source code.")
-				return
+				t.markPrevious()
+				t.reportError(ERR_STRAY_CARRIAGE_RETURN, "Stray carriage return character in source code.")
+				continue
 			}
 			t.advance()
-			t.newline(true)
+			t.commentNewline()
 			continue
 		}
 		if t.peek(0) == '\n' {
 			t.advance()
-			t.newline(true)
+			t.commentNewline()
+			continue
+		}
+		if t.peek(0) == '/' && t.peek(1) == '*' {
+			t.advance()
+			t.advance()
+			depth++
 			continue
 		}
 		if t.peek(0) == '*' && t.peek(1) == '/' {
 			t.advance()
 			t.advance()
-			return
+			depth--
+			if depth == 0 {
+				return
+			}
+			continue
 		}
 		t.advance()
 	}
 }
 
-
-
-func (t *Tokenizer) newline(make bool) {
+// newline moves to the next line and, if make is set and the line break ends
+// a statement, queues a NEWLINE token for it. It reports whether it did.
+func (t *Tokenizer) newline(make bool) bool {
+	made := false
 	// Don't overwrite a previous newline token.
-	if make && !t.pendingNewline {
-		lineToken := t.makeToken(NEWLINE)
-		lineToken.StartLine = t.line
-		lineToken.EndLine = t.line
-		lineToken.StartColumn = t.column - 1
-		lineToken.EndColumn = t.column
+	if make && !t.pendingNewline && t.endsStatement() {
+		t.markPrevious()
+		// No other token is made before scan returns this one.
+		t.makeToken(NEWLINE)
 		t.pendingNewline = true
-		t.lastToken = lineToken
-		t.lastNewline = lineToken
+		made = true
 	}
 
 	t.line++
-	t.column = 1
+	t.newColumns()
+	return made
+}
+
+// newColumns starts counting columns at the current position.
+func (t *Tokenizer) newColumns() {
+	t.lineOffset = t.offset()
+	t.shifts = [COLUMN_BYTE + 1]int{}
+}
+
+// endsStatement reports whether a line break at the current position ends a
+// statement. Inside parentheses, brackets and embedded expressions it never
+// does, so they can span lines freely. Elsewhere it depends on the last
+// token, following Token.CanEndStatement.
+func (t *Tokenizer) endsStatement() bool {
+	if n := len(t.parenStack); n > 0 && (t.parenStack[n-1] != '{' || t.inInterpolation()) {
+		return false
+	}
+	return statementEnders[t.lastType]
+}
+
+// statementEnders marks the token types a line break ends the statement
+// after, see Token.CanEndStatement.
+var statementEnders = func() (table [256]bool) {
+	for tokenType := range table {
+		table[tokenType] = Token{Type: TokenType(tokenType)}.CanEndStatement()
+	}
+	return table
+}()
+
+// commentNewline handles a line break inside a block comment. It still ends
+// the statement, but the break is part of the comment's text, so the NEWLINE
+// token is empty.
+func (t *Tokenizer) commentNewline() {
+	if t.newline(true) {
+		lineToken := &t.token
+		lineToken.Source = lineToken.Source[:0]
+		lineToken.Span.End = lineToken.Span.Start
+		lineToken.EndColumn = lineToken.StartColumn
+		lineToken.CursorPosition = -1
+		lineToken.CursorPlace = CURSOR_NONE
+		t.flagCursor(lineToken)
+	}
 }
 
 func (t *Tokenizer) number() *Token {
+	negated := t.lastType == MINUS
 	start := t._current - 1
-	first := t.source[start]
+	first := rune(t.source[start])
 
 	if first == '0' {
 		switch t.peek(0) {
@@ -275,7 +890,7 @@ func (t *Tokenizer) number() *Token {
 			digits := 0
 			for {
 				ch := t.peek(0)
-				if ch == '_' || ch == ',' {
+				if ch == '_' {
 					t.advance()
 					continue
 				}
@@ -287,52 +902,31 @@ func (t *Tokenizer) number() *Token {
 				break
 			}
 			if digits == 0 {
-				return t.makeError("Expected digits after base prefix.")
+				return t.makeError(ERR_INVALID_NUMBER, "Expected digits after base prefix.")
 			}
 			raw := string(t.source[start:t._current])
-			clean := removeSeparators(raw)[2:]
-			value, err := strconv.ParseInt(clean, base, 64)
-			if err != nil {
-				return t.makeError("Invalid numeric literal.")
+			kind, ok := t.numberSuffix()
+			if !ok {
+				return t.makeError(ERR_INVALID_NUMBER, "Invalid numeric literal suffix.")
 			}
-			return t.makeLiteral(value)
-		}
-	}
-
-	sawDot := first == '.'
-	if !sawDot {
-		for {
-			ch := t.peek(0)
-			if isDigit(ch) || ch == '_' || ch == ',' {
-				t.advance()
-			} else {
-				break
+			if kind.IsFloat() {
+				return t.makeError(ERR_INVALID_NUMBER, "Integers with a base prefix can't have a floating-point suffix.")
 			}
+			return t.typeNumber(t.makeInteger(raw[2:], base), kind, negated)
 		}
 	}
 
+	sawDot := first == '.'
 	if sawDot {
-		for {
-			ch := t.peek(0)
-			if isDigit(ch) || ch == '_' || ch == ',' {
-				t.advance()
-			} else {
-				break
-			}
-		}
+		t.decimalDigits(-1)
+	} else {
+		t.decimalDigits(1)
 	}
 
 	if !sawDot && t.peek(0) == '.' && isDigit(t.peek(1)) {
 		sawDot = true
 		t.advance()
-		for {
-			ch := t.peek(0)
-			if isDigit(ch) || ch == '_' || ch == ',' {
-				t.advance()
-			} else {
-				break
-			}
-		}
+		t.decimalDigits(-1)
 	}
 
 	sawExp := false
@@ -343,32 +937,143 @@ func (t *Tokenizer) number() *Token {
 			t.advance()
 		}
 		if !isDigit(t.peek(0)) {
-			return t.makeError("Expected exponent digits after 'e'.")
+			return t.makeError(ERR_INVALID_NUMBER, "Expected exponent digits after 'e'.")
+		}
+		t.decimalDigits(-1)
+	}
+
+	raw := string(t.source[start:t._current])
+	kind, ok := t.numberSuffix()
+	if !ok {
+		return t.makeError(ERR_INVALID_NUMBER, "Invalid numeric literal suffix.")
+	}
+	if sawDot || sawExp || kind.IsFloat() {
+		if kind != NUMBER_UNTYPED && !kind.IsFloat() {
+			return t.makeError(ERR_INVALID_NUMBER, "Floating-point literals can't have an integer suffix.")
+		}
+		value, err := strconv.ParseFloat(removeSeparators(raw), 64)
+		if err != nil {
+			return t.makeError(ERR_INVALID_NUMBER, "Invalid numeric literal.")
+		}
+		return t.typeNumber(t.makeLiteral(value), kind, negated)
+	}
+	return t.typeNumber(t.makeInteger(raw, 10), kind, negated)
+}
+
+// numberSuffix consumes a type suffix such as "u8" or "f32" after the digits
+// of a number. A letter that isn't followed by a digit starts an identifier
+// instead, so "1if" still reads as a number followed by a keyword.
+func (t *Tokenizer) numberSuffix() (NumberKind, bool) {
+	switch t.peek(0) {
+	case 'i', 'u', 'f':
+		if !isDigit(t.peek(1)) {
+			return NUMBER_UNTYPED, true
+		}
+	default:
+		return NUMBER_UNTYPED, true
+	}
+	start := t._current
+	t.skipIdentifier()
+	kind, ok := numberSuffixes[t.source[start:t._current]]
+	return kind, ok
+}
+
+// typeNumber records the kind requested by a suffix on a number literal and
+// reports values that don't fit it. The literal is kept either way. negated
+// tells whether the literal follows a MINUS.
+func (t *Tokenizer) typeNumber(token *Token, kind NumberKind, negated bool) *Token {
+	if token.Type != LITERAL || kind == NUMBER_UNTYPED {
+		return token
+	}
+	token.NumberKind = kind
+	if kind.IsFloat() {
+		if value := token.Literal.(float64); kind == NUMBER_F32 && math.Abs(value) > math.MaxFloat32 {
+			t.report(token.Span, SEVERITY_ERROR, ERR_NUMBER_OUT_OF_RANGE, fmt.Sprintf("Value doesn't fit in %s.", kind))
 		}
-		for {
-			ch := t.peek(0)
-			if isDigit(ch) || ch == '_' || ch == ',' {
+		return token
+	}
+	value, _ := token.IntValue()
+	fits := IntFits(value, kind.Bits(), kind.Signed())
+	if kind.Signed() && negated {
+		// Literals carry no sign, "-128i8" is MINUS and then 128, so after a
+		// MINUS a signed kind takes one past its maximum.
+		fits = IntFits(new(big.Int).Neg(value), kind.Bits(), true)
+	}
+	if !fits {
+		low, high := kind.IntRange()
+		t.report(token.Span, SEVERITY_ERROR, ERR_NUMBER_OUT_OF_RANGE, fmt.Sprintf("Value %s doesn't fit in %s (%s to %s).", value, kind, low, high))
+	}
+	return token
+}
+
+// decimalDigits consumes decimal digits and "_" separators. In comma
+// separator mode, the integer part of a number may also use "," between
+// thousand groups. leading is how many digits of the first group were already
+// consumed, or -1 where commas aren't allowed. A comma is only a separator
+// when the first group has one to three digits and every later group has
+// exactly three, so "f(1,2)" and "1, 2 when" keep their commas.
+func (t *Tokenizer) decimalDigits(leading int) {
+	grouped := false
+	for {
+		ch := t.peek(0)
+		switch {
+		case isDigit(ch):
+			if leading >= 0 && !grouped {
+				leading++
+			}
+			t.advance()
+		case ch == '_':
+			// Don't mix the two kinds of separator.
+			leading = -1
+			t.advance()
+		case ch == ',' && t.commaSeparators && leading >= 1 && leading <= 3 && t.isThousandGroup():
+			grouped = true
+			for i := 0; i < 4; i++ {
 				t.advance()
-			} else {
-				break
 			}
+		default:
+			return
 		}
 	}
+}
 
-	raw := string(t.source[start:t._current])
-	clean := removeSeparators(raw)
-	if sawDot || sawExp {
-		value, err := strconv.ParseFloat(clean, 64)
-		if err != nil {
-			return t.makeError("Invalid numeric literal.")
+// isThousandGroup reports whether the comma at the current position is
+// followed by exactly three digits.
+func (t *Tokenizer) isThousandGroup() bool {
+	next := t.peek(4)
+	return isDigit(t.peek(1)) && isDigit(t.peek(2)) && isDigit(t.peek(3)) && !isDigit(next) && next != '_'
+}
+
+// makeInteger makes an integer literal holding the exact value of digits,
+// which may contain separators. Values that fit in an int64 are stored as
+// one, larger values as a *big.Int. Whether the value fits its eventual type
+// is checked once that is known.
+func (t *Tokenizer) makeInteger(digits string, base int) *Token {
+	if len(digits) <= 15 {
+		// Fifteen digits fit in an int64 in any base up to 16, so there's
+		// nothing to check.
+		var value int64
+		for i := 0; i < len(digits); i++ {
+			switch c := digits[i]; {
+			case c == '_' || c == ',':
+			case c <= '9':
+				value = value*int64(base) + int64(c-'0')
+			default:
+				value = value*int64(base) + int64(c|0x20-'a'+10)
+			}
 		}
 		return t.makeLiteral(value)
 	}
-	value, err := strconv.ParseInt(clean, 10, 64)
-	if err != nil {
-		return t.makeError("Invalid numeric literal.")
+	digits = removeSeparators(digits)
+	value, err := strconv.ParseInt(digits, base, 64)
+	if err == nil {
+		return t.makeLiteral(value)
 	}
-	return t.makeLiteral(value)
+	exact, ok := new(big.Int).SetString(digits, base)
+	if !ok {
+		return t.makeError(ERR_INVALID_NUMBER, "Invalid numeric literal.")
+	}
+	return t.makeLiteral(exact)
 }
 
 func isDigitForBase(ch rune, base int) bool {
@@ -385,6 +1090,13 @@ func isDigitForBase(ch rune, base int) bool {
 }
 
 func removeSeparators(s string) string {
+	i := 0
+	for i < len(s) && s[i] != '_' && s[i] != ',' {
+		i++
+	}
+	if i == len(s) {
+		return s
+	}
 	var b strings.Builder
 	b.Grow(len(s))
 	for _, r := range s {
@@ -396,118 +1108,560 @@ func removeSeparators(s string) string {
 	return b.String()
 }
 
-func (t *Tokenizer) stringToken() *Token {
-	quote := t.peek(-1)
-	result := ""
+// stringFrame describes the delimiters of the string being scanned, so an
+// interpolated string can resume after each embedded expression.
+type stringFrame struct {
+	quote  rune
+	triple bool
+	raw    bool
+	indent int // Indentation stripped from each line, or -1.
+	depth  int // Length of parenStack with the interpolation brace pushed.
+}
+
+type stringStop int
+
+const (
+	stopClosed stringStop = iota
+	stopInterpolation
+	stopUnterminated
+)
+
+// stringToken scans a string literal whose opening quote was just consumed.
+// Raw strings keep their content verbatim: a backslash only stops the next
+// quote or backslash from ending the string, and both characters are kept.
+// Three quotes open a multi-line string that ends at the next three quotes.
+func (t *Tokenizer) stringToken(raw bool) *Token {
+	frame := t.openString(raw)
+	value, stop := t.stringPart(&frame, false)
+	if stop == stopUnterminated {
+		return t.makeError(ERR_UNTERMINATED_STRING, "Unterminated string")
+	}
+	return t.makeLiteral(value)
+}
+
+// interpolatedString scans an f-string whose opening quote was just consumed.
+// Each "{" starts an embedded expression that is tokenized normally until the
+// matching "}", so the string is split into INTERPOLATION_START, optional
+// INTERPOLATION_MIDDLE and INTERPOLATION_END fragments around the expression
+// tokens. A string without expressions is a plain literal.
+func (t *Tokenizer) interpolatedString() *Token {
+	frame := t.openString(false)
+	value, stop := t.stringPart(&frame, true)
+	switch stop {
+	case stopUnterminated:
+		return t.makeError(ERR_UNTERMINATED_STRING, "Unterminated string")
+	case stopClosed:
+		return t.makeLiteral(value)
+	}
+	return t.beginInterpolation(frame, INTERPOLATION_START, value)
+}
+
+// beginInterpolation is called once the "{" of an embedded expression has
+// been consumed. The brace goes on parenStack like any other so nesting and
+// mismatches inside the expression are handled as usual.
+func (t *Tokenizer) beginInterpolation(frame stringFrame, tokenType TokenType, fragment string) *Token {
+	t.pushParen('{')
+	frame.depth = len(t.parenStack)
+	t.interpolations = append(t.interpolations, frame)
+	token := t.makeToken(tokenType)
+	token.Literal = fragment
+	return token
+}
+
+// inInterpolation reports whether a "}" would close an embedded expression.
+func (t *Tokenizer) inInterpolation() bool {
+	n := len(t.interpolations)
+	return n > 0 && t.interpolations[n-1].depth == len(t.parenStack)
+}
+
+// resumeInterpolation continues an interpolated string after the "}" that
+// closed an embedded expression.
+func (t *Tokenizer) resumeInterpolation() *Token {
+	frame := t.interpolations[len(t.interpolations)-1]
+	t.interpolations = t.interpolations[:len(t.interpolations)-1]
+	t.parenStack = t.parenStack[:len(t.parenStack)-1]
+	value, stop := t.stringPart(&frame, true)
+	switch stop {
+	case stopUnterminated:
+		return t.makeError(ERR_UNTERMINATED_STRING, "Unterminated string")
+	case stopClosed:
+		token := t.makeToken(INTERPOLATION_END)
+		token.Literal = value
+		return token
+	}
+	return t.beginInterpolation(frame, INTERPOLATION_MIDDLE, value)
+}
+
+// openString consumes the rest of the opening delimiter of a string.
+func (t *Tokenizer) openString(raw bool) stringFrame {
+	frame := stringFrame{quote: t.peek(-1), raw: raw, indent: -1}
+	frame.triple = t.peek(0) == frame.quote && t.peek(1) == frame.quote
+	if frame.triple {
+		t.advance()
+		t.advance()
+		if t.stripIndent {
+			frame.indent = t.stringIndent(frame.quote)
+			if t.skipBlankOpeningLine() {
+				t.skipIndent(frame.indent)
+			}
+		}
+	}
+	return frame
+}
+
+// stringPart scans string content up to and including the closing quotes or,
+// in an interpolated string, the "{" opening an embedded expression. The
+// value is a slice of the source until something in it needs translating,
+// such as an escape sequence, and only then is copied.
+func (t *Tokenizer) stringPart(frame *stringFrame, interpolated bool) (string, stringStop) {
+	quote := frame.quote
+	start := t._current
+	var result []byte
+	direct := true
+	materialize := func() {
+		if direct {
+			result = append(t.scratch[:0], t.source[start:t._current]...)
+			direct = false
+		}
+	}
+	length := func() int {
+		if direct {
+			return t._current - start
+		}
+		return len(result)
+	}
+	// Where the last line break starts in the value, and whether the line
+	// after it holds nothing but indentation so far.
+	lastBreak := -1
+	onlyIndent := false
+	stop := stopClosed
+	end := 0
 	for {
-		c := t.peek(0)
 		if t.isAtEnd() {
-			return t.makeError("Unterminated string")
+			return "", stopUnterminated
 		}
-		if c == quote {
+		c := t.peek(0)
+		if c == quote && (!frame.triple || (t.peek(1) == quote && t.peek(2) == quote)) {
+			end = length()
 			t.advance()
+			if frame.triple {
+				t.advance()
+				t.advance()
+			}
 			break
 		}
-		if c == '\\' {
+		switch {
+		case !frame.triple && (c == '\n' || (c == '\r' && t.peek(1) == '\n')):
+			// Only triple-quoted strings span lines. The line break is left
+			// for the next token so scanning resumes on the next line.
+			return "", stopUnterminated
+		case c == '\r' && t.peek(1) == '\n':
+			// Line breaks in the source are always read as "\n".
+			materialize()
 			t.advance()
-			c = t.peek(0)
+		case c == '\n':
+			lastBreak = length()
+			onlyIndent = true
+			if !direct {
+				result = append(result, '\n')
+			}
 			t.advance()
-			switch c {
-			case 'n':
-				result += "\n"
-			case 't':
-				result += "\t"
-			case '\\':
-				result += "\\"
-			case '"':
-				result += "\""
-			default:
-				result += string(c)
+			t.newline(false)
+			if frame.indent > 0 {
+				materialize()
+				t.skipIndent(frame.indent)
+			}
+		case interpolated && c == '{':
+			end = length()
+			t.advance()
+			if t.peek(0) != '{' {
+				stop = stopInterpolation
+				break
+			}
+			onlyIndent = false
+			if !direct {
+				result = append(result, '{')
+			}
+			materialize()
+			t.advance()
+			continue
+		case interpolated && c == '}':
+			begin := t.pos()
+			onlyIndent = false
+			t.advance()
+			if !direct {
+				result = append(result, '}')
 			}
+			if t.peek(0) == '}' {
+				materialize()
+				t.advance()
+			} else {
+				t.reportFrom(begin, ERR_INVALID_INTERPOLATION, `Single "}" in interpolated string.`)
+				t.lastDiagnostic().Fix = &SuggestedFix{
+					Message:     `Write "}}" for a literal brace.`,
+					Span:        Span{File: t.file, Start: begin, End: t.pos()},
+					Replacement: "}}",
+				}
+			}
+			continue
+		case c != '\\':
+			if c != ' ' && c != '\t' {
+				onlyIndent = false
+			}
+			from := t._current
+			t.advance()
+			if !direct {
+				result = append(result, t.source[from:t._current]...)
+			}
+			continue
+		case frame.raw:
+			onlyIndent = false
+			from := t._current
+			t.advance()
+			if next := t.peek(0); next == quote || next == '\\' {
+				t.advance()
+			}
+			if !direct {
+				result = append(result, t.source[from:t._current]...)
+			}
+			continue
+		default:
+			onlyIndent = false
+			materialize()
+			result = t.escape(result)
+			continue
+		}
+		if stop == stopInterpolation {
+			break
+		}
+	}
+	// The line holding the closing quotes only sets the indentation.
+	if stop == stopClosed && frame.indent >= 0 && onlyIndent {
+		end = lastBreak
+	}
+	if direct {
+		return t.source[start : start+end], stop
+	}
+	value := string(result[:end])
+	t.scratch = result[:0]
+	return value, stop
+}
+
+// nodePath scans a ^"path" literal and validates the path.
+func (t *Tokenizer) nodePath() *Token {
+	token := t.stringToken(false)
+	value, ok := token.Literal.(string)
+	if !ok || token.Type != LITERAL {
+		return token
+	}
+	path, err := ParseNodePath(value)
+	if err != nil {
+		t.report(token.Span, SEVERITY_ERROR, ERR_INVALID_NODE_PATH, err.Error())
+	}
+	token.Literal = path
+	return token
+}
+
+// nodeReference scans the node path after a "$", as in $Path/To/Node,
+// $Path/"Some Node", $"Some Node/Child" or $%Unique. Each segment is a name
+// or a quoted string, either optionally marked unique with "%", and a quoted
+// segment may hold any part of a path. A "/" continues the path only when a
+// segment follows right after it. A "$" without a path is a DOLLAR token.
+func (t *Tokenizer) nodeReference() *Token {
+	if !t.nodeSegmentAhead(0) {
+		return t.makeToken(DOLLAR)
+	}
+	// The path is a slice of the source until a quoted segment needs
+	// decoding.
+	var decoded strings.Builder
+	quoted := false
+	for {
+		from := t._current
+		if t.peek(0) == '%' {
+			t.advance()
+		}
+		if c := t.peek(0); c == '"' || c == '\'' {
+			if !quoted {
+				decoded.WriteString(t.source[t._start+1 : from])
+				quoted = true
+			}
+			decoded.WriteString(t.source[from:t._current])
+			t.advance()
+			frame := t.openString(false)
+			value, stop := t.stringPart(&frame, false)
+			if stop == stopUnterminated {
+				return t.makeError(ERR_UNTERMINATED_STRING, "Unterminated string")
+			}
+			decoded.WriteString(value)
 		} else {
-			result += string(c)
-			t.advance()
-		}
-	}
-	return t.makeLiteral(result)
-}
-
-var keywordsByFirst = map[rune]map[string]TokenType{
-	'a': {
-		"as":  AS,
-		"and": AND,
-	},
-	'b': {
-		"break": BREAK,
-	},
-	'c': {
-		"class":    CLASS,
-		"const":    CONST,
-		"continue": CONTINUE,
-	},
-	'e': {
-		"elif":    ELIF,
-		"else":    ELSE,
-		"enum":    ENUM,
-		"extends": EXTENDS,
-	},
-	'f': {
-		"for": FOR,
-		"fn":  FUNCTION,
-	},
-	'i': {
-		"if":     IF,
-		"import": IMPORT,
-		"in":     IN,
-		"is":     IS,
-	},
-	'm': {
-		"match": MATCH,
-		"mod":   MOD,
-	},
-	'n': {
-		"not": NOT,
-	},
-	'o': {
-		"or": OR,
-	},
-	'p': {
-		"pass": PASS,
-	},
-	'r': {
-		"return": RETURN,
-	},
-	's': {
-		"self":   SELF,
-		"signal": SIGNAL,
-	},
-	't': {
-		"trait": TRAIT,
-		"type":  TYPE,
-	},
-	'u': {
-		"uses": USES,
-	},
-	'v': {
-		"var":  VAR,
-		"void": VOID,
-	},
-	'w': {
-		"while": WHILE,
-		"when":  WHEN,
-	},
-	'I': {
-		"INF": CONST_INF,
-	},
-	'N': {
-		"NAN": CONST_NAN,
-	},
-	'P': {
-		"PI": CONST_PI,
-	},
-	'T': {
-		"TAU": CONST_TAU,
-	},
+			t.advance()
+			t.skipIdentifier()
+			if quoted {
+				decoded.WriteString(t.source[from:t._current])
+			}
+		}
+		if t.peek(0) != '/' || !t.nodeSegmentAhead(1) {
+			break
+		}
+		t.advance()
+		if quoted {
+			decoded.WriteByte('/')
+		}
+	}
+	token := t.makeToken(NODE_REFERENCE)
+	path := token.Source[1:]
+	if quoted {
+		path = decoded.String()
+	}
+	literal, err := ParseNodePath(path)
+	if err != nil {
+		t.report(token.Span, SEVERITY_ERROR, ERR_INVALID_NODE_PATH, err.Error())
+	}
+	token.Literal = literal
+	return token
+}
+
+// nodeSegmentAhead reports whether a node name or quoted string, optionally
+// marked unique with "%", starts offset bytes ahead.
+func (t *Tokenizer) nodeSegmentAhead(offset int) bool {
+	if t.peekAhead(offset) == '%' {
+		offset++
+	}
+	if !t.ensure(t._current + offset) {
+		return false
+	}
+	c, _ := utf8.DecodeRuneInString(t.source[t._current+offset:])
+	return c == '"' || c == '\'' || isUnicodeIdentifierStart(c)
+}
+
+// stringIndent looks ahead through a multi-line string and returns the
+// indentation shared by every line after the first that has content. A
+// closing line holding nothing but indentation also counts.
+func (t *Tokenizer) stringIndent(quote rune) int {
+	indent := -1
+	lineIndent := 0
+	atLineStart := false
+	for i := 0; t.ensure(t._current + i); i++ {
+		c := t.peek(i)
+		switch {
+		case c == quote && t.peekAhead(i+1) == quote && t.peekAhead(i+2) == quote:
+			if atLineStart && (indent < 0 || lineIndent < indent) {
+				indent = lineIndent
+			}
+			return max(indent, 0)
+		case c == '\n':
+			atLineStart = true
+			lineIndent = 0
+		case c == '\r':
+		case atLineStart && (c == ' ' || c == '\t'):
+			lineIndent++
+		default:
+			if atLineStart && (indent < 0 || lineIndent < indent) {
+				indent = lineIndent
+			}
+			atLineStart = false
+			if c == '\\' {
+				// Don't let an escaped quote end the string.
+				i++
+			}
+		}
+	}
+	return max(indent, 0)
+}
+
+// skipIndent skips up to indent spaces or tabs at the start of a line.
+func (t *Tokenizer) skipIndent(indent int) {
+	for skipped := 0; skipped < indent && (t.peek(0) == ' ' || t.peek(0) == '\t'); skipped++ {
+		t.advance()
+	}
+}
+
+// skipBlankOpeningLine drops the rest of the line after the opening quotes
+// of a multi-line string if it is blank, and reports whether it did.
+func (t *Tokenizer) skipBlankOpeningLine() bool {
+	i := 0
+	for t.peekAhead(i) == ' ' || t.peekAhead(i) == '\t' {
+		i++
+	}
+	if t.peekAhead(i) == '\r' && t.peekAhead(i+1) == '\n' {
+		i++
+	}
+	if t.peekAhead(i) != '\n' {
+		return false
+	}
+	for ; i >= 0; i-- {
+		t.advance()
+	}
+	t.newline(false)
+	return true
+}
+
+// escape decodes the escape sequence starting at the current backslash and
+// appends the result to b. Invalid escapes are reported and kept verbatim.
+func (t *Tokenizer) escape(b []byte) []byte {
+	start := t.pos()
+	t.advance() // Backslash.
+	if t.isAtEnd() {
+		// Reported as an unterminated string by the caller.
+		return b
+	}
+	c := t.advance()
+	switch c {
+	case 'n':
+		b = append(b, '\n')
+	case 't':
+		b = append(b, '\t')
+	case 'r':
+		b = append(b, '\r')
+	case 'a':
+		b = append(b, '\a')
+	case 'b':
+		b = append(b, '\b')
+	case 'f':
+		b = append(b, '\f')
+	case 'v':
+		b = append(b, '\v')
+	case '0':
+		b = append(b, 0)
+	case '\\', '"', '\'':
+		b = utf8.AppendRune(b, c)
+	case '\n':
+		// Line continuation.
+		t.newline(false)
+	case '\r':
+		if t.peek(0) == '\n' {
+			t.advance()
+			t.newline(false)
+		} else {
+			t.reportFrom(start, ERR_STRAY_CARRIAGE_RETURN, "Stray carriage return character in source code.")
+		}
+	case 'x':
+		if value, ok := t.hexEscape(start, 2); ok {
+			b = utf8.AppendRune(b, value)
+		}
+	case 'U':
+		value, ok := t.hexEscape(start, 8)
+		if !ok {
+			break
+		}
+		if value < 0 || value > unicode.MaxRune || (value >= 0xD800 && value <= 0xDFFF) {
+			t.reportFrom(start, ERR_INVALID_ESCAPE, "Invalid Unicode code point in escape sequence.")
+			b = utf8.AppendRune(b, utf8.RuneError)
+			break
+		}
+		b = utf8.AppendRune(b, value)
+	case 'u':
+		value, ok := t.hexEscape(start, 4)
+		if !ok {
+			break
+		}
+		switch {
+		case value >= 0xD800 && value <= 0xDBFF:
+			// A high surrogate must be followed by an escaped low surrogate.
+			if t.peek(0) == '\\' && t.peek(1) == 'u' {
+				lowStart := t.pos()
+				t.advance()
+				t.advance()
+				low, ok := t.hexEscape(lowStart, 4)
+				if !ok {
+					break
+				}
+				if low >= 0xDC00 && low <= 0xDFFF {
+					b = utf8.AppendRune(b, 0x10000+(value-0xD800)<<10+(low-0xDC00))
+					break
+				}
+			}
+			t.reportFrom(start, ERR_INVALID_ESCAPE, "Invalid UTF-16 sequence in string, unpaired high surrogate.")
+			b = utf8.AppendRune(b, utf8.RuneError)
+		case value >= 0xDC00 && value <= 0xDFFF:
+			t.reportFrom(start, ERR_INVALID_ESCAPE, "Invalid UTF-16 sequence in string, unpaired low surrogate.")
+			b = utf8.AppendRune(b, utf8.RuneError)
+		default:
+			b = utf8.AppendRune(b, value)
+		}
+	default:
+		t.reportFrom(start, ERR_INVALID_ESCAPE, fmt.Sprintf(`Invalid escape in string "\%c".`, c))
+		b = utf8.AppendRune(b, c)
+	}
+	return b
+}
+
+// hexEscape reads exactly digits hexadecimal digits of an escape sequence.
+func (t *Tokenizer) hexEscape(start Position, digits int) (rune, bool) {
+	var value rune
+	for i := 0; i < digits; i++ {
+		ch := t.peek(0)
+		if !isDigitForBase(ch, 16) {
+			t.reportFrom(start, ERR_INVALID_ESCAPE, fmt.Sprintf("Invalid hexadecimal escape, expected %d digits.", digits))
+			return 0, false
+		}
+		t.advance()
+		switch {
+		case ch >= 'a':
+			value = value*16 + ch - 'a' + 10
+		case ch >= 'A':
+			value = value*16 + ch - 'A' + 10
+		default:
+			value = value*16 + ch - '0'
+		}
+	}
+	return value, true
+}
+
+type keyword struct {
+	name      string
+	tokenType TokenType
+	literal   interface{}
+}
+
+// keywordTable is a perfect hash table of the reserved words, including the
+// literals true, false and null: keywordHash puts each of them in a slot of
+// its own, so a lookup is one multiplication and one string comparison.
+var keywordTable [64]keyword
+
+func keywordHash(name string) uint32 {
+	key := uint32(len(name))<<24 | uint32(name[0])<<16 | uint32(name[1])<<8 | uint32(name[len(name)-1])
+	return key * 0x25c00295 >> 26
+}
+
+func init() {
+	keywords := []keyword{
+		{"as", AS, "as"}, {"and", AND, "and"},
+		{"break", BREAK, "break"},
+		{"class", CLASS, "class"}, {"const", CONST, "const"}, {"continue", CONTINUE, "continue"},
+		{"elif", ELIF, "elif"}, {"else", ELSE, "else"}, {"enum", ENUM, "enum"}, {"extends", EXTENDS, "extends"},
+		{"for", FOR, "for"}, {"fn", FUNCTION, "fn"}, {"false", LITERAL, false},
+		{"if", IF, "if"}, {"import", IMPORT, "import"}, {"in", IN, "in"}, {"is", IS, "is"},
+		{"match", MATCH, "match"}, {"mod", MOD, "mod"},
+		{"not", NOT, "not"}, {"null", LITERAL, nil},
+		{"or", OR, "or"},
+		{"pass", PASS, "pass"},
+		{"return", RETURN, "return"},
+		{"self", SELF, "self"}, {"signal", SIGNAL, "signal"},
+		{"trait", TRAIT, "trait"}, {"type", TYPE, "type"}, {"true", LITERAL, true},
+		{"uses", USES, "uses"},
+		{"var", VAR, "var"}, {"void", VOID, "void"},
+		{"while", WHILE, "while"}, {"when", WHEN, "when"},
+		{"INF", CONST_INF, "INF"}, {"NAN", CONST_NAN, "NAN"}, {"PI", CONST_PI, "PI"}, {"TAU", CONST_TAU, "TAU"},
+	}
+	for _, k := range keywords {
+		slot := &keywordTable[keywordHash(k.name)]
+		if slot.name != "" {
+			panic("tokenizer: keyword hash collision between " + slot.name + " and " + k.name)
+		}
+		*slot = k
+	}
+}
+
+// lookupKeyword returns the keyword spelled name, or nil.
+func lookupKeyword(name string) *keyword {
+	if len(name) < MinKeywordLength || len(name) > MaxKeywordLength {
+		return nil
+	}
+	if k := &keywordTable[keywordHash(name)]; k.name == name {
+		return k
+	}
+	return nil
 }
 
 const (
@@ -515,49 +1669,57 @@ const (
 	MaxKeywordLength = 10
 )
 
-func (t *Tokenizer) potentialIdentifier() *Token {
-	start := t._current - 1
-	for isUnicodeIdentifierContinue(t.peek(0)) {
-		t.advance()
+// asciiIdentifier marks the ASCII characters that can continue an identifier.
+var asciiIdentifier = func() (table [256]bool) {
+	for c := range utf8.RuneSelf {
+		table[c] = isUnicodeIdentifierContinue(rune(c))
 	}
-	name := string(t.source[start:t._current])
-	length := len(name)
+	return table
+}()
 
-	if length >= MinKeywordLength && length <= MaxKeywordLength {
-		switch length {
-		case 4:
-			if name == "true" {
-				return t.makeLiteral(true)
-			}
-			if name == "null" {
-				return t.makeLiteral(nil)
-			}
-		case 5:
-			if name == "false" {
-				return t.makeLiteral(false)
-			}
+// skipIdentifier consumes the characters that can continue an identifier.
+func (t *Tokenizer) skipIdentifier() {
+	for {
+		src, i := t.source, t._current
+		for i < len(src) && asciiIdentifier[src[i]] {
+			i++
 		}
-		first := []rune(name)[0]
-		if group, ok := keywordsByFirst[first]; ok {
-			if tokenType, ok := group[name]; ok {
-				newToken := t.makeToken(tokenType)
-				newToken.Literal = name
-				return newToken
+		t.skipASCII(i - t._current)
+		if t.isAtEnd() {
+			return
+		}
+		if c := t.source[t._current]; c < utf8.RuneSelf {
+			if !asciiIdentifier[c] {
+				return
 			}
+			continue
 		}
-		
+		if !isUnicodeIdentifierContinue(t.peekRune()) {
+			return
+		}
+		t.advance()
+	}
+}
+
+func (t *Tokenizer) potentialIdentifier() *Token {
+	t.skipIdentifier()
+	name := t.source[t._start:t._current]
+	if k := lookupKeyword(name); k != nil {
+		token := t.makeToken(k.tokenType)
+		token.Literal = k.literal
+		return token
 	}
 	return t.makeIdentifier(name)
 }
 
+// checkVCSMarker scans a doubled operator or, from seven characters on, a
+// conflict marker that is not part of a complete region, which is an error.
 func (t *Tokenizer) checkVCSMarker(test rune, doubleType TokenType) *Token {
-	chars := 2             // two already matched
-	next := t.position + 1 // lookahead index
+	chars := 2 // two already matched
 
 	// Count consecutive matching runes WITHOUT consuming
-	for next < t.length && t.source[next] == test {
+	for t.peekAhead(chars-1) == test {
 		chars++
-		next++
 	}
 
 	if chars >= 7 {
@@ -566,7 +1728,9 @@ func (t *Tokenizer) checkVCSMarker(test rune, doubleType TokenType) *Token {
 			t.advance() // first char already consumed by Scan()
 			chars--
 		}
-		return t.makeToken(VCS_CONFLICT_MARKER)
+		token := t.makeToken(VCS_CONFLICT_MARKER)
+		t.report(token.Span, SEVERITY_ERROR, ERR_MERGE_CONFLICT, "Merge conflict marker outside of a conflict region.")
+		return token
 	}
 
 	// Regular double-character token (==, <<, >>, etc.)
@@ -575,40 +1739,65 @@ func (t *Tokenizer) checkVCSMarker(test rune, doubleType TokenType) *Token {
 }
 
 func (t *Tokenizer) annotation() *Token {
-	if isUnicodeIdentifierStart(t.peek(0)) {
+	if isUnicodeIdentifierStart(t.peekRune()) {
 		t.advance()
 	} else {
-		panic("Expected annotation identifier after \"@\".")
-	}
-	for isUnicodeIdentifierContinue(t.peek(0)) {
-		t.advance()
+		return t.makeError(ERR_EXPECTED_ANNOTATION_NAME, "Expected annotation identifier after \"@\".")
 	}
+	t.skipIdentifier()
 	annotationToken := t.makeToken(ANNOTATION)
-	annotationToken.Literal = string(annotationToken.Source)
+	annotationToken.Literal, _ = t.intern(annotationToken.Source, annotationToken.Span.Start)
 	return annotationToken
 }
 
-func (t *Tokenizer) Scan() *Token {
-	if t.hasError() {
-		return t.popError()
+// SetKeepTrivia makes every token carry the whitespace and comments around
+// it as LeadingTrivia and TrailingTrivia, so the source can be rebuilt from
+// the token stream.
+func (t *Tokenizer) SetKeepTrivia(enabled bool) {
+	t.keepTrivia = enabled
+}
+
+// Scan returns the next token. It is kept small enough to be inlined, so a
+// caller that only looks at some fields of the token doesn't copy all of it.
+func (t *Tokenizer) Scan() Token {
+	return *t.next()
+}
+
+// next scans the next token and attaches its doc comment and trivia.
+func (t *Tokenizer) next() *Token {
+	token := t.scan()
+	// Only pending doc comments and annotations give attachDoc work to do.
+	if t.annotationArgs != 0 || len(t.docLines) > 0 || token.Type == ANNOTATION {
+		t.attachDoc(token)
 	}
+	if t.keepTrivia && token.Type != NEWLINE && token.Type != EOF {
+		t.scanTrailingTrivia(token)
+	}
+	return token
+}
+
+func (t *Tokenizer) scan() *Token {
+	t.compact()
+	t.refill()
 
 	t.skipWhitespace()
 
 	if t.pendingNewline {
 		t.pendingNewline = false
-		return t.lastNewline
-	}
-
-	if t.hasError() {
-		return t.popError()
+		return &t.token
 	}
 
-	t._start = t._current
-	t.startLine = t.line
-	t.startColumn = t.column
+	t.markStart()
 
 	if t.isAtEnd() {
+		if len(t.interpolations) > 0 {
+			t.interpolations = nil
+			t.reportError(ERR_UNTERMINATED_STRING, "Unterminated interpolated string.")
+		}
+		if t.endsStatement() {
+			// End the last statement even without a final line break.
+			return t.makeToken(NEWLINE)
+		}
 		return t.makeToken(EOF)
 	}
 
@@ -618,15 +1807,21 @@ func (t *Tokenizer) Scan() *Token {
 		return t.number()
 	} else if c == 'r' && (t.peek(0) == '"' || t.peek(0) == '\'') {
 		// Raw string literals.
-		return t.stringToken()
-	} else if isUnicodeIdentifierStart(c) {
+		t.advance()
+		return t.stringToken(true)
+	} else if c == 'f' && (t.peek(0) == '"' || t.peek(0) == '\'') {
+		// Interpolated string literals.
+		t.advance()
+		return t.interpolatedString()
+	} else if c < utf8.RuneSelf && asciiIdentifier[c] || c >= utf8.RuneSelf && isUnicodeIdentifierStart(c) {
+		// Digits were handled above, so the table tells ASCII starts.
 		return t.potentialIdentifier()
 	}
 
 	// Single-char tokens
 	switch c {
 	case '"', '\'':
-		return t.stringToken()
+		return t.stringToken(false)
 	case '@':
 		return t.annotation()
 	case '~':
@@ -638,7 +1833,7 @@ func (t *Tokenizer) Scan() *Token {
 	case ';':
 		return t.makeToken(SEMICOLON)
 	case '$':
-		return t.makeToken(DOLLAR)
+		return t.nodeReference()
 	case '?':
 		return t.makeToken(QUESTION_MARK)
 	case '`':
@@ -663,6 +1858,9 @@ func (t *Tokenizer) Scan() *Token {
 		}
 		return t.makeToken(BRACKET_CLOSE)
 	case '}':
+		if t.inInterpolation() {
+			return t.resumeInterpolation()
+		}
 		if !t.popParen('{') {
 			return t.makeParenError(c)
 		}
@@ -693,9 +1891,6 @@ func (t *Tokenizer) Scan() *Token {
 		if t.peek(0) == '=' {
 			t.advance()
 			return t.makeToken(PLUS_EQUAL)
-		} else if isDigit(t.peek(0)) && !t.lastToken.CanPrecedeBinOP() {
-			// Number starting with '+'.
-			return t.number()
 		} else {
 			return t.makeToken(PLUS)
 		}
@@ -703,9 +1898,6 @@ func (t *Tokenizer) Scan() *Token {
 		if t.peek(0) == '=' {
 			t.advance()
 			return t.makeToken(MINUS_EQUAL)
-		} else if isDigit(t.peek(0)) && !t.lastToken.CanPrecedeBinOP() {
-			// Number starting with '-'.
-			return t.number()
 		} else if t.peek(0) == '>' {
 			t.advance()
 			return t.makeToken(FORWARD_ARROW)
@@ -747,7 +1939,8 @@ func (t *Tokenizer) Scan() *Token {
 			return t.makeToken(CARET_EQUAL)
 		} else if t.peek(0) == '"' || t.peek(0) == '\'' {
 			// Node path
-			return t.stringToken()
+			t.advance()
+			return t.nodePath()
 		} else {
 			return t.makeToken(CARET)
 		}
@@ -760,7 +1953,12 @@ func (t *Tokenizer) Scan() *Token {
 			return t.makeToken(AMPERSAND_EQUAL)
 		} else if t.peek(0) == '"' || t.peek(0) == '\'' {
 			// String Name
-			return t.stringToken()
+			t.advance()
+			token := t.stringToken(false)
+			if value, ok := token.Literal.(string); ok && token.Type == LITERAL {
+				token.Literal = StringNameLiteral(value)
+			}
+			return token
 		} else {
 			return t.makeToken(AMPERSAND)
 		}
@@ -813,11 +2011,6 @@ func (t *Tokenizer) Scan() *Token {
 			return t.makeToken(GREATER)
 		}
 	default:
-		if isWhitespace(c) {
-			t.skipWhitespace()
-			return t.Scan()
-		} else {
-			return t.makeError(fmt.Sprintf(`Invalid character "%c"`, c))
-		}
+		return t.makeError(ERR_INVALID_CHARACTER, fmt.Sprintf(`Invalid character "%c"`, c))
 	}
 }
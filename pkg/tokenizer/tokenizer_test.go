@@ -0,0 +1,152 @@
+package tokenizer
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// benchmarkSource returns about size bytes of typical source: classes with
+// doc comments, annotations, strings, numbers and nested blocks, with names
+// that vary so identifiers aren't all served from one cache entry.
+func benchmarkSource(size int) string {
+	var b strings.Builder
+	for i := 0; b.Len() < size; i++ {
+		fmt.Fprintf(&b, `/// Enemy number %[1]d.
+class Enemy%[1]d extends Node {
+	# Tunables.
+	@export var health: i32 = %[1]d
+	const SPEED_%[1]d = 12.5f32
+	var name = "enemy \"%[1]d\"\n"
+	var mask = 0xFF_%[2]X
+	/* Cached lookups,
+	   filled on ready. */
+	var target = $Path/To/Target%[1]d
+
+	fn hit(amount = 3, source = null) {
+		health -= amount * 2 // damage
+		if (health <= 0 && !dead_%[1]d) { emit_signal(&"died", self); }
+		var message = f"hp {health} of {max_health_%[1]d} left"
+		for i in range(0, amount) {
+			spawn_particle(position + Vector2(i * 1.5e2, -i), [1, 2, 3])
+		}
+	}
+}
+
+`, i, i%4096)
+	}
+	return b.String()
+}
+
+func BenchmarkScan(b *testing.B) {
+	src := benchmarkSource(1 << 20)
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	for b.Loop() {
+		tokenizer := NewTokenizer(src)
+		for tokenizer.Scan().Type != EOF {
+		}
+	}
+}
+
+func TestNodeReference(t *testing.T) {
+	tests := []struct {
+		src   string
+		names []string
+		sub   []string
+		types []TokenType // After the NODE_REFERENCE when not nil.
+	}{
+		{`$Child`, []string{"Child"}, nil, nil},
+		{`$Path/To/Node`, []string{"Path", "To", "Node"}, nil, nil},
+		{`$%Unique/Child`, []string{"%Unique", "Child"}, nil, nil},
+		{`$"Some Node"`, []string{"Some Node"}, nil, nil},
+		{`$"Some Node/Child:prop"`, []string{"Some Node", "Child"}, []string{"prop"}, nil},
+		{`$Path/"Some Node"/Child`, []string{"Path", "Some Node", "Child"}, nil, nil},
+		{`$%"Quoted Unique"`, []string{"%Quoted Unique"}, nil, nil},
+		{`$Path/%'Quoted \'Unique\''`, []string{"Path", "%Quoted 'Unique'"}, nil, nil},
+		{`$Path / 2`, []string{"Path"}, nil, []TokenType{SLASH, LITERAL}},
+		{`$"A"/"B".x`, []string{"A", "B"}, nil, []TokenType{PERIOD, IDENTIFIER}},
+	}
+	for _, test := range tests {
+		tokens, diagnostics := Tokenize(test.src)
+		if len(diagnostics) > 0 {
+			t.Errorf("%s: %v", test.src, diagnostics)
+		}
+		path, ok := tokens[0].Literal.(NodePathLiteral)
+		if tokens[0].Type != NODE_REFERENCE || !ok {
+			t.Errorf("%s: got %s %#v", test.src, tokens[0].GetDebugName(), tokens[0].Literal)
+			continue
+		}
+		if !slices.Equal(path.Names, test.names) || !slices.Equal(path.SubNames, test.sub) {
+			t.Errorf("%s: names %q subnames %q, want %q %q", test.src, path.Names, path.SubNames, test.names, test.sub)
+		}
+		var types []TokenType
+		for _, token := range tokens[1:] {
+			if token.Type != NEWLINE && token.Type != EOF {
+				types = append(types, token.Type)
+			}
+		}
+		if !slices.Equal(types, test.types) {
+			t.Errorf("%s: followed by %v, want %v", test.src, types, test.types)
+		}
+	}
+}
+
+func TestNumberSuffixRange(t *testing.T) {
+	tests := []struct {
+		src  string
+		fits bool
+	}{
+		{"127i8", true},
+		{"128i8", false},
+		{"-128i8", true},
+		{"- 128i8", true},
+		{"-129i8", false},
+		{"x - 128i8", true}, // The tokenizer can't tell a binary minus.
+		{"2147483647i32", true},
+		{"2147483648i32", false},
+		{"-2147483648i32", true},
+		{"255u8", true},
+		{"256u8", false},
+		{"0xFFu8", true},
+		{"0x80i8", false},
+		{"-0x80i8", true},
+		{"9223372036854775808i64", false},
+		{"-9223372036854775808i64", true},
+		{"1e39f32", false},
+		{"1e38f32", true},
+	}
+	for _, test := range tests {
+		_, diagnostics := Tokenize(test.src)
+		fits := true
+		for _, d := range diagnostics {
+			fits = fits && d.Code != ERR_NUMBER_OUT_OF_RANGE
+		}
+		if fits != test.fits {
+			t.Errorf("%s: fits = %v, want %v (%v)", test.src, fits, test.fits, diagnostics)
+		}
+	}
+}
+
+func TestIntegerValues(t *testing.T) {
+	tests := []struct {
+		src  string
+		want interface{}
+	}{
+		{"0", int64(0)},
+		{"1_000", int64(1000)},
+		{"0xFF_ff", int64(255*256 + 255)},
+		{"0b1010_1010", int64(170)},
+		{"0o7_7", int64(63)},
+		{"999999999999999", int64(999999999999999)},
+		{"9223372036854775807", int64(9223372036854775807)},
+		{"0x7FFF_FFFF_FFFF_FFFF", int64(9223372036854775807)},
+	}
+	for _, test := range tests {
+		tokens, _ := Tokenize(test.src)
+		if got := tokens[0].Literal; got != test.want {
+			t.Errorf("%s: %v, want %v", test.src, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package tokenizer
+
+import "strings"
+
+type TriviaKind int
+
+const (
+	TRIVIA_WHITESPACE TriviaKind = iota
+	TRIVIA_NEWLINE
+	TRIVIA_LINE_COMMENT
+	TRIVIA_BLOCK_COMMENT
+	TRIVIA_DOC_COMMENT // A "///" or "##" line comment.
+	TRIVIA_CONFLICT    // What is left out of a version control conflict region.
+	TRIVIA_SHEBANG     // A "#!" line at the start of the file.
+	TRIVIA_BYTE_ORDER_MARK
+)
+
+// Trivia is source text between tokens that doesn't affect the meaning of
+// the program. Together with the source of every token, the leading and
+// trailing trivia reproduce the original file exactly.
+type Trivia struct {
+	Kind TriviaKind
+	Text string
+	Span Span
+}
+
+// appendTrivia adds the text consumed since start, at byte offset idx in
+// t.source, to list. Runs of whitespace are merged into one piece.
+func (t *Tokenizer) appendTrivia(list []Trivia, kind TriviaKind, start Position, idx int) []Trivia {
+	text := t.source[idx:t._current]
+	if n := len(list); n > 0 && kind == TRIVIA_WHITESPACE && list[n-1].Kind == TRIVIA_WHITESPACE && list[n-1].Span.End == start {
+		list[n-1].Text += text
+		list[n-1].Span.End = t.pos()
+		return list
+	}
+	return append(list, Trivia{Kind: kind, Text: text, Span: Span{File: t.file, Start: start, End: t.pos()}})
+}
+
+// scanTrailingTrivia attaches the whitespace and comments that follow token
+// on the same line. Everything from the line break on belongs to the next
+// token.
+func (t *Tokenizer) scanTrailingTrivia(token *Token) {
+	for {
+		start, idx := t.pos(), t._current
+		kind := TRIVIA_WHITESPACE
+		switch c := t.peek(0); {
+		case c != '\n' && c != '\r' && isWhitespace(t.peekRune()):
+			t.advance()
+		case c == '#' || (c == '/' && t.peek(1) == '/'):
+			kind = TRIVIA_LINE_COMMENT
+			if t.isDocComment() {
+				kind = TRIVIA_DOC_COMMENT
+			}
+			t.skipLineComment()
+		case c == '/' && t.peek(1) == '*' && t.blockCommentEndsOnLine():
+			kind = TRIVIA_BLOCK_COMMENT
+			t.advance()
+			t.advance()
+			t.skipBlockComment()
+		default:
+			return
+		}
+		token.TrailingTrivia = t.appendTrivia(token.TrailingTrivia, kind, start, idx)
+	}
+}
+
+// blockCommentEndsOnLine reports whether the block comment at the current
+// position is closed before the end of the line.
+func (t *Tokenizer) blockCommentEndsOnLine() bool {
+	depth := 1
+	for i := 2; t.ensure(t._current + i); i++ {
+		switch t.peek(i) {
+		case '\n':
+			return false
+		case '/':
+			if t.peekAhead(i+1) == '*' {
+				depth++
+				i++
+			}
+		case '*':
+			if t.peekAhead(i+1) == '/' {
+				depth--
+				if depth == 0 {
+					return true
+				}
+				i++
+			}
+		}
+	}
+	return false
+}
+
+// isDocComment reports whether the line comment at the current position is a
+// documentation comment: "///" or "##", but not "////" or "###".
+func (t *Tokenizer) isDocComment() bool {
+	switch t.peek(0) {
+	case '#':
+		return t.peek(1) == '#' && t.peek(2) != '#'
+	case '/':
+		return t.peek(1) == '/' && t.peek(2) == '/' && t.peek(3) != '/'
+	default:
+		return false
+	}
+}
+
+// startsLine reports whether nothing but whitespace precedes the current
+// position on its line. Doc comments after code on the same line don't
+// document the next declaration.
+func (t *Tokenizer) startsLine() bool {
+	return t.lastType == EMPTY || t.lastLine < t.line
+}
+
+// docText strips the comment marker and a single following space.
+func docText(comment string) string {
+	if comment[0] == '#' {
+		comment = comment[2:]
+	} else {
+		comment = comment[3:]
+	}
+	if len(comment) > 0 && comment[0] == ' ' {
+		comment = comment[1:]
+	}
+	return comment
+}
+
+// attachDoc hands pending doc comment lines to the declaration keyword they
+// document. They carry over line breaks and annotations, including the
+// annotation arguments, and are dropped by any other token.
+func (t *Tokenizer) attachDoc(token *Token) {
+	previous := t.annotationArgs
+	t.annotationArgs = nextAnnotationArgs(previous, token.Type, len(t.parenStack))
+	if previous > 0 || t.annotationArgs != 0 || token.Type == NEWLINE {
+		return
+	}
+	switch token.Type {
+	case CLASS, TRAIT, FUNCTION, VAR, CONST, SIGNAL, ENUM:
+		if len(t.docLines) > 0 {
+			token.Doc = strings.Join(t.docLines, "\n")
+			t.docLines = nil
+		}
+	default:
+		t.docLines = nil
+	}
+}
+
+// nextAnnotationArgs tracks whether tokens belong to the argument list of an
+// annotation. The state is 0 outside of one, -1 right after an annotation
+// and otherwise the paren depth of its argument list.
+func nextAnnotationArgs(state int, tokenType TokenType, depth int) int {
+	switch {
+	case state > 0:
+		if depth < state {
+			return 0
+		}
+		return state
+	case tokenType == ANNOTATION:
+		return -1
+	case tokenType == PARENTHESIS_OPEN && state < 0:
+		return depth
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,51 @@
+package tokenizer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTriviaRoundTrip(t *testing.T) {
+	sources := []string{
+		"",
+		"\n\n",
+		"var x = 1\n",
+		"var x = 1",
+		"var x = 1\r\nvar y = 2\r\n",
+		"if x:\r\n\tpass # comment\r\n",
+		"var a = 1 /* one\n  two\r\n three */ + 2\n",
+		"/* outer /* inner\n */ still */ var a\n",
+		"\uFEFFvar x = 1\n",
+		"#!/usr/bin/env ruzta\nvar x = 1\n",
+		"\uFEFF#!/usr/bin/env ruzta\r\nvar x = 1\r\n",
+		"var x = 1\n<<<<<<< ours\nvar y = 2\n=======\nvar y = 3\n>>>>>>> theirs\nvar z\n",
+		"<<<<<<< HEAD\r\nf(1)\r\n||||||| base\r\nf(0)\r\n=======\r\nf(2)\r\n>>>>>>> branch\r\n",
+		"var s = f\"a {x} b {y:>8} {{c}}\" # end\n",
+		"var s = f\"\"\"\n  {a +\n b}\n\"\"\"\n",
+		"func f(\n\ta, # first\n\tb\n):\n\treturn \\\n\t\ta\n",
+		"/// Doc.\n@export_range(1, 10) var x\n",
+		"var x = \"unterminated\n",
+		"var x = 1 ~ 2 $\n",
+	}
+	resolutions := []ConflictResolution{CONFLICT_SKIP, CONFLICT_OURS, CONFLICT_THEIRS}
+	for _, src := range sources {
+		for _, resolution := range resolutions {
+			tokenizer := NewTokenizer(src)
+			tokenizer.SetKeepTrivia(true)
+			tokenizer.SetConflictResolution(resolution)
+			var b strings.Builder
+			for token := range tokenizer.Tokens() {
+				for _, trivia := range token.LeadingTrivia {
+					b.WriteString(trivia.Text)
+				}
+				b.WriteString(token.Source)
+				for _, trivia := range token.TrailingTrivia {
+					b.WriteString(trivia.Text)
+				}
+			}
+			if got := b.String(); got != src {
+				t.Errorf("resolution %d: rebuilt\n%q\nwant\n%q", resolution, got, src)
+			}
+		}
+	}
+}